@@ -3,24 +3,85 @@ package client
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
-// Client struct holds the host on which music_player is running
+// Client struct holds the host on which music_player is running,
+// the API token sent with every request (empty if the service needs no token)
+// and how the certificate of an https host is trusted
 type Client struct {
-	Host string
+	Host  string
+	Token string
+	// PEM file with the CA certificates (or the self-signed certificate) trusted instead of the system ones
+	CAFile string
+	// SHA-256 fingerprint of the server certificate. If set, only this certificate is accepted
+	Fingerprint string
+}
+
+// httpClient creates the HTTP client that trusts the configured CA or certificate fingerprint
+// Returns error if the CA file cannot be read
+func (client *Client) httpClient() (*http.Client, error) {
+	if len(client.CAFile) == 0 && len(client.Fingerprint) == 0 {
+		return &http.Client{}, nil
+	}
+	tlsConfig := &tls.Config{}
+	if len(client.CAFile) > 0 {
+		pemCerts, err := ioutil.ReadFile(client.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemCerts) {
+			return nil, fmt.Errorf("no certificates found in %s", client.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(client.Fingerprint) > 0 {
+		pinned := normalizeFingerprint(client.Fingerprint)
+		if len(client.CAFile) == 0 {
+			// the pinned certificate replaces the verification of the chain
+			tlsConfig.InsecureSkipVerify = true
+		}
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("no server certificate")
+			}
+			hash := sha256.Sum256(rawCerts[0])
+			if hex.EncodeToString(hash[:]) != pinned {
+				return errors.New("server certificate does not match the pinned fingerprint")
+			}
+			return nil
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, nil
+}
+
+// normalizeFingerprint lowercases a fingerprint and removes the colons e.g. from "AB:CD:..."
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
 }
 
 // getAlive checks if music_player is running
 func (client *Client) getAlive() string {
-	response, err := http.Get(client.Host)
+	httpClient, err := client.httpClient()
+	if err != nil {
+		fmt.Println(err.Error())
+		return ""
+	}
+	response, err := httpClient.Get(client.Host)
 	if err != nil {
 		fmt.Println("The service is not alive")
 		return ""
@@ -36,7 +97,7 @@ func (client *Client) getAlive() string {
 // Constructs a message from the json response and displays it
 func (client *Client) PerformAction(action string, name string) string {
 	path := name
-	if action != "save" && client.isLocalhostCall() {
+	if isFileAction(action) && client.isLocalhostCall() {
 		var err error = nil
 		path, err = filepath.Abs(name)
 		if err != nil {
@@ -49,8 +110,19 @@ func (client *Client) PerformAction(action string, name string) string {
 			path = name
 		}
 	}
-	response, err := performCall(determineHttpMethod(action), client.formUrl(action, path))
-	return getDisplayMessage(response, err)
+	response, err := client.performCall(determineHttpMethod(action, name), client.formUrl(action, path))
+	message := getDisplayMessage(response, err)
+	if err == nil && response.Code == 0 && len(response.Info) > 0 {
+		if infoMessage := getInfoMessage(action, response.Info); len(infoMessage) > 0 {
+			message = message + "\n" + infoMessage
+		}
+	}
+	return message
+}
+
+// isFileAction checks if the name of the action is a song, a directory or a playlist
+func isFileAction(action string) bool {
+	return action == "play" || action == "add"
 }
 
 // isLocalhostCall checks if music_player's host is localhost
@@ -63,25 +135,36 @@ func (client *Client) isLocalhostCall() bool {
 
 // determineHttpMethod determines which method (GET, POST or PUT) is going to be used for the
 // HTTP request
-func determineHttpMethod(action string) (method string) {
+func determineHttpMethod(action string, name string) (method string) {
 	switch action {
 	case
 		"songinfo",
 		"queueinfo",
-		"playlists":
+		"playlists",
+		"playlist",
+		"search":
 		method = "GET"
 
 	case "next",
 		"previous",
 		"pause",
 		"resume",
-		"add":
+		"add",
+		"seek":
 		method = "POST"
 
 	case "play",
 		"save",
+		"crossfade",
 		"stop":
 		method = "PUT"
+
+	case "volume",
+		"mode":
+		method = "PUT"
+		if len(name) == 0 {
+			method = "GET"
+		}
 	}
 	return method
 }
@@ -102,40 +185,262 @@ func (client *Client) formUrl(action string, name string) (requestUrl string) {
 
 	case "add",
 		"play",
-		"save":
+		"save",
+		"seek",
+		"crossfade":
 		requestUrl = client.Host + action + "/" + escape(name)
+
+	case "search":
+		requestUrl = client.Host + action + "?q=" + url.QueryEscape(name)
+
+	case "playlist":
+		requestUrl = client.Host + "playlists/" + escape(name)
+
+	case "volume":
+		requestUrl = client.Host + action
+		if len(name) > 0 {
+			requestUrl = requestUrl + "/" + escape(name)
+		}
+
+	case "mode":
+		// repeat-all becomes mode/repeat/all
+		requestUrl = client.Host + action
+		if len(name) > 0 {
+			parts := strings.SplitN(name, "-", 2)
+			for _, part := range parts {
+				requestUrl = requestUrl + "/" + escape(part)
+			}
+		}
 	}
 
 	return requestUrl
 }
 
 // ResponseContainer struct is used to hold the unmarshalled json response of music_player
-// Contains code (0 for succes, 1 for failure), message and a list of file names
+// Contains code (0 for succes, 1 for failure), message, a list of file names
+// and structured info that depends on the action
 type ResponseContainer struct {
 	Code    int
 	Message string
 	Data    []string
+	Info    json.RawMessage
 }
 
-// performCall send HTTP request to music_player, gets json the response and unmarshals it
-func performCall(method string, url string) (ResponseContainer, error) {
-	var res *http.Response
-	var err error
-	container := ResponseContainer{}
+// SongInfo struct holds the info about the current song returned by songinfo
+type SongInfo struct {
+	Name       string
+	Status     string
+	Elapsed    float64
+	Duration   float64
+	Index      int
+	SampleRate float64
+	Channels   uint
+	Tags       *Tags
+}
+
+// Tags struct holds the title, artist, album etc. of a song
+type Tags struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Track       int
+	Disc        int
+	Year        string
+	Genre       string
+}
 
-	if method == "GET" {
-		res, err = http.Get(url)
-	} else if method == "POST" {
-		res, err = http.Post(url, "text/plain", nil)
-	} else if method == "PUT" {
-		client := &http.Client{}
-		request, err1 := http.NewRequest("PUT", url, nil)
-		if err1 != nil {
-			return container, err1
+// TrackInfo struct holds a track of the library returned by search
+// The id can be used with play and add
+type TrackInfo struct {
+	Id   string
+	Name string
+	Tags
+	Duration float64
+}
+
+// getTracksMessage creates a line for every track with its id and its artist and title
+// e.g. "track:3fa2c1d09b7e4a15 Artist - Title (Album)". Tracks without title are named by their file
+func getTracksMessage(tracks []TrackInfo) string {
+	lines := make([]string, 0, len(tracks))
+	for _, track := range tracks {
+		name := getTagsMessage(&track.Tags)
+		if len(name) == 0 {
+			name = track.Name
 		}
-		res, err = client.Do(request)
+		lines = append(lines, track.Id+" "+name)
 	}
+	return strings.Join(lines, "\n")
+}
 
+// PlaylistEntryInfo struct holds a song of a saved playlist returned by playlist
+type PlaylistEntryInfo struct {
+	Name     string
+	Title    string
+	Duration float64
+	Tags     *Tags
+	Missing  bool
+}
+
+// getPlaylistMessage creates a numbered line for every song of a playlist named by its tags,
+// its title in the playlist or its file e.g. "1. Artist - Title (Album)"
+func getPlaylistMessage(entries []PlaylistEntryInfo) string {
+	lines := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		name := getTagsMessage(entry.Tags)
+		if len(name) == 0 {
+			name = entry.Title
+		}
+		if len(name) == 0 {
+			name = entry.Name
+		}
+		if entry.Missing {
+			name = name + " (missing)"
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getTagsMessage creates a line naming the song from its tags e.g. "Artist - Title (Album)"
+// Returns empty string if the song has no title
+func getTagsMessage(tags *Tags) string {
+	if tags == nil || len(tags.Title) == 0 {
+		return ""
+	}
+	message := tags.Title
+	if len(tags.Artist) > 0 {
+		message = tags.Artist + " - " + message
+	}
+	if len(tags.Album) > 0 {
+		message = message + " (" + tags.Album + ")"
+	}
+	return message
+}
+
+// VolumeInfo struct holds the volume returned by the volume action
+type VolumeInfo struct {
+	Percent  float64
+	Decibels *float64
+	Muted    bool
+}
+
+// getInfoMessage creates a message from the structured info returned for the action
+// Returns empty string if the action has no info to display
+func getInfoMessage(action string, data json.RawMessage) string {
+	switch action {
+	case "songinfo":
+		info := SongInfo{}
+		if json.Unmarshal(data, &info) == nil {
+			return getSongInfoMessage(info)
+		}
+	case "volume":
+		info := VolumeInfo{}
+		if json.Unmarshal(data, &info) == nil {
+			return getVolumeMessage(info)
+		}
+	case "mode",
+		"crossfade":
+		info := ModeInfo{}
+		if json.Unmarshal(data, &info) == nil {
+			return getModeMessage(info)
+		}
+	case "queueinfo":
+		info := QueueInfo{}
+		if json.Unmarshal(data, &info) == nil {
+			return fmt.Sprintf("current song %d, %s", info.Current+1, getModeMessage(info.ModeInfo))
+		}
+	case "search":
+		tracks := make([]TrackInfo, 0)
+		if json.Unmarshal(data, &tracks) == nil {
+			return getTracksMessage(tracks)
+		}
+	case "playlist":
+		entries := make([]PlaylistEntryInfo, 0)
+		if json.Unmarshal(data, &entries) == nil {
+			return getPlaylistMessage(entries)
+		}
+	}
+	return ""
+}
+
+// ModeInfo struct holds the repeat and shuffle modes and the crossfade returned by the mode action
+type ModeInfo struct {
+	Repeat    string
+	Shuffle   bool
+	Crossfade float64
+}
+
+// QueueInfo struct holds the current song and the modes returned by the queueinfo action
+type QueueInfo struct {
+	ModeInfo
+	Current int
+	Order   []int
+}
+
+// getModeMessage creates a line describing the modes e.g. "repeat all, shuffle on, crossfade 5s"
+func getModeMessage(info ModeInfo) string {
+	shuffle := "off"
+	if info.Shuffle {
+		shuffle = "on"
+	}
+	message := fmt.Sprintf("repeat %s, shuffle %s", info.Repeat, shuffle)
+	if info.Crossfade > 0 {
+		message += ", crossfade " + strconv.FormatFloat(info.Crossfade, 'f', -1, 64) + "s"
+	}
+	return message
+}
+
+// getVolumeMessage creates a line describing the volume e.g. "50% (-6.0 dB)" or "50% (-6.0 dB) muted"
+func getVolumeMessage(info VolumeInfo) string {
+	message := fmt.Sprintf("%.0f%%", info.Percent)
+	if info.Decibels != nil {
+		message = message + fmt.Sprintf(" (%.1f dB)", *info.Decibels)
+	}
+	if info.Muted {
+		message = message + " muted"
+	}
+	return message
+}
+
+// getSongInfoMessage creates a line describing the playback of the current song
+// e.g. "playing 0:12 / 3:05 (song 2, 44100 Hz, 2 channels)"
+// The artist and title come first if the song has tags
+func getSongInfoMessage(info SongInfo) string {
+	message := fmt.Sprintf("%s %s / %s (song %d, %.0f Hz, %d channels)", info.Status, formatSeconds(info.Elapsed),
+		formatSeconds(info.Duration), info.Index+1, info.SampleRate, info.Channels)
+	if tags := getTagsMessage(info.Tags); len(tags) > 0 {
+		message = tags + ", " + message
+	}
+	return message
+}
+
+// formatSeconds formats seconds as minutes:seconds
+func formatSeconds(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// performCall send HTTP request to music_player, gets json the response and unmarshals it
+// The token is sent as a bearer token if it is not empty
+func (client *Client) performCall(method string, url string) (ResponseContainer, error) {
+	container := ResponseContainer{}
+
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return container, err
+	}
+	if method == "POST" {
+		request.Header.Set("Content-Type", "text/plain")
+	}
+	if len(client.Token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+client.Token)
+	}
+	httpClient, err := client.httpClient()
+	if err != nil {
+		return container, err
+	}
+	res, err := httpClient.Do(request)
 	if err != nil {
 		return container, err
 	}
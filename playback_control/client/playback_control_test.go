@@ -2,8 +2,16 @@ package client
 
 import "github.com/katya-spasova/music_player/player"
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -48,6 +56,30 @@ func TestFormUrl(t *testing.T) {
 	checkStr(t, "http://localhost:8765/songinfo", cl.formUrl("songinfo", "djkfd"))
 	checkStr(t, "http://localhost:8765/queueinfo", cl.formUrl("queueinfo", "djkfd"))
 	checkStr(t, "http://localhost:8765/playlists", cl.formUrl("playlists", "djkfd"))
+	checkStr(t, "http://localhost:8765/seek/%2B30", cl.formUrl("seek", "+30"))
+	checkStr(t, "http://localhost:8765/seek/-10", cl.formUrl("seek", "-10"))
+	checkStr(t, "http://localhost:8765/volume", cl.formUrl("volume", ""))
+	checkStr(t, "http://localhost:8765/volume/-6dB", cl.formUrl("volume", "-6dB"))
+	checkStr(t, "http://localhost:8765/volume/mute", cl.formUrl("volume", "mute"))
+	checkStr(t, "http://localhost:8765/mode", cl.formUrl("mode", ""))
+	checkStr(t, "http://localhost:8765/mode/repeat/all", cl.formUrl("mode", "repeat-all"))
+	checkStr(t, "http://localhost:8765/mode/shuffle/on", cl.formUrl("mode", "shuffle-on"))
+	checkStr(t, "http://localhost:8765/crossfade/5", cl.formUrl("crossfade", "5"))
+	checkStr(t, "http://localhost:8765/search?q=beep+artist%3A%22the+testers%22",
+		cl.formUrl("search", `beep artist:"the testers"`))
+	checkStr(t, "http://localhost:8765/playlists/my%20list.m3u", cl.formUrl("playlist", "my list.m3u"))
+}
+
+func TestDetermineHttpMethod(t *testing.T) {
+	checkStr(t, "PUT", determineHttpMethod("play", "test_sounds/beep9.mp3"))
+	checkStr(t, "POST", determineHttpMethod("seek", "+30"))
+	checkStr(t, "GET", determineHttpMethod("volume", ""))
+	checkStr(t, "PUT", determineHttpMethod("volume", "50"))
+	checkStr(t, "GET", determineHttpMethod("mode", ""))
+	checkStr(t, "PUT", determineHttpMethod("mode", "repeat-one"))
+	checkStr(t, "PUT", determineHttpMethod("crossfade", "0"))
+	checkStr(t, "GET", determineHttpMethod("search", "beep"))
+	checkStr(t, "GET", determineHttpMethod("playlist", "list.m3u"))
 }
 
 func TestDisplayMessage(t *testing.T) {
@@ -77,7 +109,8 @@ func TestPerformCallPut(t *testing.T) {
 	defer ts.Close()
 	defer player.WaitEnd()
 
-	responseContainer, err := performCall("PUT", ts.URL+"/play/"+escape("../../player/test_sounds/beep9.mp3"))
+	cl := Client{}
+	responseContainer, err := cl.performCall("PUT", ts.URL+"/play/"+escape("../../player/test_sounds/beep9.mp3"))
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -90,7 +123,8 @@ func TestPerformCallGet(t *testing.T) {
 	defer ts.Close()
 	defer player.WaitEnd()
 
-	responseContainer, err := performCall("GET", ts.URL+"/songinfo")
+	cl := Client{}
+	responseContainer, err := cl.performCall("GET", ts.URL+"/songinfo")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -103,7 +137,8 @@ func TestPerformCallPost(t *testing.T) {
 	defer ts.Close()
 	defer player.WaitEnd()
 
-	responseContainer, err := performCall("POST", ts.URL+"/pause")
+	cl := Client{}
+	responseContainer, err := cl.performCall("POST", ts.URL+"/pause")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -111,12 +146,83 @@ func TestPerformCallPost(t *testing.T) {
 	checkInt(t, 1, responseContainer.Code)
 }
 
+func TestPerformCallToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkStr(t, "Bearer s3cret", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"Code":0,"Message":"Queue content"}`)
+	}))
+	defer ts.Close()
+
+	cl := Client{Token: "s3cret"}
+	responseContainer, err := cl.performCall("GET", ts.URL+"/queueinfo")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	checkInt(t, 0, responseContainer.Code)
+}
+
+func TestPerformCallPinnedCertificate(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Code":0,"Message":"Queue content"}`)
+	}))
+	defer ts.Close()
+
+	hash := sha256.Sum256(ts.Certificate().Raw)
+	cl := Client{Fingerprint: strings.ToUpper(hex.EncodeToString(hash[:]))}
+	_, err := cl.performCall("GET", ts.URL+"/queueinfo")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	cl = Client{Fingerprint: "00" + hex.EncodeToString(hash[1:])}
+	_, err = cl.performCall("GET", ts.URL+"/queueinfo")
+	if err == nil {
+		t.Error("Error Expected")
+	}
+
+	cl = Client{}
+	_, err = cl.performCall("GET", ts.URL+"/queueinfo")
+	if err == nil {
+		t.Error("Error Expected")
+	}
+}
+
+func TestPerformCallCAFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Code":0,"Message":"Queue content"}`)
+	}))
+	defer ts.Close()
+
+	caFile, err := ioutil.TempFile("", "music_player_ca")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	caFile.Close()
+
+	cl := Client{CAFile: caFile.Name()}
+	responseContainer, err := cl.performCall("GET", ts.URL+"/queueinfo")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	checkInt(t, 0, responseContainer.Code)
+
+	cl = Client{CAFile: "no_such_ca.pem"}
+	_, err = cl.performCall("GET", ts.URL+"/queueinfo")
+	if err == nil {
+		t.Error("Error Expected")
+	}
+}
+
 func TestPerformCallError(t *testing.T) {
 	ts := httptest.NewServer(player.InitService(playlistsDir))
 	defer ts.Close()
 	defer player.WaitEnd()
 
-	_, err := performCall("GET", ts.URL+"/pause")
+	cl := Client{}
+	_, err := cl.performCall("GET", ts.URL+"/pause")
 	if err == nil {
 		t.Error("Error Expected")
 	}
@@ -135,6 +241,42 @@ beep9.mp3`
 	checkStr(t, expected, found)
 }
 
+func TestSongInfoMessage(t *testing.T) {
+	info := SongInfo{Name: "beep28.mp3", Status: "playing", Elapsed: 72.6, Duration: 185, Index: 1,
+		SampleRate: 44100, Channels: 2}
+	checkStr(t, "playing 1:12 / 3:05 (song 2, 44100 Hz, 2 channels)", getSongInfoMessage(info))
+	info.Tags = &Tags{Title: "Beep", Artist: "Tester", Album: "Beeps", Track: 2}
+	checkStr(t, "Tester - Beep (Beeps), playing 1:12 / 3:05 (song 2, 44100 Hz, 2 channels)", getSongInfoMessage(info))
+	info.Tags = &Tags{Artist: "Tester"}
+	checkStr(t, "playing 1:12 / 3:05 (song 2, 44100 Hz, 2 channels)", getSongInfoMessage(info))
+}
+
+func TestTracksMessage(t *testing.T) {
+	info := []byte(`[{"Id":"track:0123456789abcdef","Name":"01.mp3","Title":"Beep","Artist":"Tester"},` +
+		`{"Id":"track:fedcba9876543210","Name":"untagged.mp3"}]`)
+	checkStr(t, "track:0123456789abcdef Tester - Beep\ntrack:fedcba9876543210 untagged.mp3",
+		getInfoMessage("search", info))
+}
+
+func TestPlaylistMessage(t *testing.T) {
+	info := []byte(`[{"Name":"01.mp3","Title":"Old title","Tags":{"Title":"Beep","Artist":"Tester"}},` +
+		`{"Name":"02.mp3","Title":"Tester - Boop","Duration":2},{"Name":"gone.mp3","Missing":true}]`)
+	checkStr(t, "1. Tester - Beep\n2. Tester - Boop\n3. gone.mp3 (missing)", getInfoMessage("playlist", info))
+}
+
+func TestVolumeMessage(t *testing.T) {
+	decibels := -6.0206
+	checkStr(t, "50% (-6.0 dB) muted", getVolumeMessage(VolumeInfo{Percent: 50, Decibels: &decibels, Muted: true}))
+	checkStr(t, "0%", getVolumeMessage(VolumeInfo{Percent: 0}))
+}
+
+func TestModeMessage(t *testing.T) {
+	checkStr(t, "repeat all, shuffle on", getModeMessage(ModeInfo{Repeat: "all", Shuffle: true}))
+	checkStr(t, "repeat off, shuffle off, crossfade 2.5s", getModeMessage(ModeInfo{Repeat: "off", Crossfade: 2.5}))
+	checkStr(t, "current song 2, repeat off, shuffle off",
+		getInfoMessage("queueinfo", []byte(`{"Repeat":"off","Shuffle":false,"Current":1}`)))
+}
+
 func TestEscape(t *testing.T) {
 	found := escape(`/abc cde\fgh.ijk`)
 	checkStr(t, "%2Fabc%20cde%5Cfgh.ijk", found)
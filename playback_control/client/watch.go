@@ -0,0 +1,100 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event struct holds an unmarshalled event of music_player
+// Contains the type of the change, error message, file names and structured info that depends on the type
+type Event struct {
+	Type    string
+	Message string
+	Data    []string
+	Info    json.RawMessage
+}
+
+// Watch follows the events of music_player and writes a line for each of them to out
+// Returns when the service closes the stream or error if the stream cannot be opened or read
+func (client *Client) Watch(out io.Writer) error {
+	request, err := http.NewRequest("GET", client.Host+"events", nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	if len(client.Token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+client.Token)
+	}
+	httpClient, err := client.httpClient()
+	if err != nil {
+		return err
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		// errors come as the usual json response
+		body, _ := ioutil.ReadAll(response.Body)
+		container := ResponseContainer{}
+		if json.Unmarshal(body, &container) == nil && len(container.Message) > 0 {
+			return fmt.Errorf("%s", container.Message)
+		}
+		return fmt.Errorf("cannot watch: %s", response.Status)
+	}
+	return readEvents(response.Body, func(event Event) {
+		fmt.Fprintf(out, "%s %s\n", time.Now().Format("15:04:05"), getEventMessage(event))
+	})
+}
+
+// readEvents reads server-sent events and calls handle for each of them
+// Comments and events that are not json are skipped
+func readEvents(stream io.Reader, handle func(Event)) error {
+	scanner := bufio.NewScanner(stream)
+	data := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case len(line) == 0:
+			// an empty line ends the event
+			event := Event{}
+			if len(data) > 0 && json.Unmarshal([]byte(data), &event) == nil {
+				handle(event)
+			}
+			data = ""
+		case strings.HasPrefix(line, "data:"):
+			data = data + strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	return scanner.Err()
+}
+
+// getEventMessage creates a line describing an event e.g. "playing beep9.mp3 0:01 / 0:04 (song 1, 44100 Hz, 2 channels)"
+func getEventMessage(event Event) string {
+	names := strings.Join(event.Data, ", ")
+	switch event.Type {
+	case "playing", "paused":
+		info := SongInfo{}
+		if json.Unmarshal(event.Info, &info) == nil {
+			return names + ": " + getSongInfoMessage(info)
+		}
+		return event.Type + " " + names
+	case "queue":
+		return fmt.Sprintf("queue changed - %d songs, %s", len(event.Data), getInfoMessage("queueinfo", event.Info))
+	case "volume":
+		return "volume " + getInfoMessage("volume", event.Info)
+	case "mode":
+		return "mode " + getInfoMessage("mode", event.Info)
+	case "error":
+		return "error: " + event.Message + " " + names
+	}
+	return event.Type
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadEvents(t *testing.T) {
+	stream := ": connected\n\n" +
+		"event: paused\n" +
+		`data: {"Type":"paused","Data":["beep9.mp3"],"Info":{"Name":"beep9.mp3","Status":"paused","Elapsed":1.5,"Duration":4,"Index":0,"SampleRate":44100,"Channels":2}}` + "\n\n" +
+		": keep-alive\n\n" +
+		"event: volume\n" +
+		`data: {"Type":"volume","Info":{"Percent":50,"Decibels":-6.0206,"Muted":false}}` + "\n\n" +
+		"event: stopped\n" +
+		`data: {"Type":"stopped"}` + "\n\n"
+	messages := make([]string, 0)
+	err := readEvents(strings.NewReader(stream), func(event Event) {
+		messages = append(messages, getEventMessage(event))
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkInt(t, 3, len(messages))
+	checkStr(t, "beep9.mp3: paused 0:01 / 0:04 (song 1, 44100 Hz, 2 channels)", messages[0])
+	checkStr(t, "volume 50% (-6.0 dB)", messages[1])
+	checkStr(t, "stopped", messages[2])
+}
+
+func TestGetEventMessage(t *testing.T) {
+	checkStr(t, "error: SoX failed to open input file abc.mp3",
+		getEventMessage(Event{Type: "error", Message: "SoX failed to open input file", Data: []string{"abc.mp3"}}))
+	checkStr(t, "queue changed - 2 songs, current song 1, repeat all, shuffle off",
+		getEventMessage(Event{Type: "queue", Data: []string{"a.mp3", "b.mp3"},
+			Info: []byte(`{"Repeat":"all","Shuffle":false,"Current":0}`)}))
+	checkStr(t, "mode repeat off, shuffle on",
+		getEventMessage(Event{Type: "mode", Info: []byte(`{"Repeat":"off","Shuffle":true}`)}))
+}
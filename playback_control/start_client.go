@@ -4,6 +4,7 @@ import "github.com/katya-spasova/music_player/playback_control/client"
 import (
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -23,7 +24,14 @@ func isValidAction(action string) bool {
 		"songinfo",
 		"queueinfo",
 		"playlists",
-		"save":
+		"playlist",
+		"save",
+		"seek",
+		"volume",
+		"mode",
+		"crossfade",
+		"search",
+		"watch":
 		return true
 	}
 	return false
@@ -32,28 +40,61 @@ func isValidAction(action string) bool {
 // main is endpoint for the music_player's client
 func main() {
 	action := flag.String("action", "stop",
-		"Use one of: play/stop/pause/resume/next/previous/add/songinfo/queueinfo/playlists/save")
+		"Use one of: play/stop/pause/resume/next/previous/add/songinfo/queueinfo/playlists/playlist/save/seek/volume/mode/crossfade/search/watch")
 
-	name := flag.String("name", "", "Name of a song, a directory or a playlist")
+	name := flag.String("name", "", "Name of a song, a directory, a playlist or the id of a track. "+
+		"Position in seconds for seek (42, +30, -10). "+
+		"Volume in percent or dB for volume (50, -6dB, mute, unmute) - empty to get the volume. "+
+		"Mode for mode (repeat-off, repeat-one, repeat-all, shuffle-on, shuffle-off) - empty to get the modes. "+
+		"Seconds the songs overlap for crossfade (5, 0 turns it off). "+
+		"Query for search (beep artist:tester year:2017)")
 
 	specifiedHost := flag.String("host", defaultHost, "Specify the host")
+	token := flag.String("token", os.Getenv("MUSIC_PLAYER_TOKEN"),
+		"API token if the service requires one. Defaults to MUSIC_PLAYER_TOKEN")
+	caFile := flag.String("ca", "", "PEM file with the CA or the self-signed certificate to trust for an https host")
+	fingerprint := flag.String("fingerprint", "",
+		"SHA-256 fingerprint of the certificate of an https host. Only this certificate is accepted")
 	flag.Parse()
 
 	if !isValidAction(*action) {
 		fmt.Println(`Unknown action. Use one of: play/stop/pause/resume/next
-		/previous/add/songinfo/queueinfo/playlists/save`)
+		/previous/add/songinfo/queueinfo/playlists/playlist/save/seek/volume/mode/crossfade/search/watch`)
 		return
 	}
 
-	if (*action == "play" || *action == "add" || *action == "save") && len(*name) == 0 {
+	if (*action == "play" || *action == "add" || *action == "save" || *action == "playlist") && len(*name) == 0 {
 		fmt.Println("file, directory or playlist name is required with this action")
 		return
 	}
 
+	if *action == "seek" && len(*name) == 0 {
+		fmt.Println("position is required with this action")
+		return
+	}
+
+	if *action == "crossfade" && len(*name) == 0 {
+		fmt.Println("seconds are required with this action")
+		return
+	}
+
+	if *action == "search" && len(*name) == 0 {
+		fmt.Println("query is required with this action")
+		return
+	}
+
 	var h = *specifiedHost
 	if strings.HasSuffix("/", h) {
 		h = h + "/"
 	}
-	cl := client.Client{Host: *specifiedHost}
+	cl := client.Client{Host: *specifiedHost, Token: *token, CAFile: *caFile, Fingerprint: *fingerprint}
+	if *action == "watch" {
+		// prints the events until the service stops or the client is interrupted
+		err := cl.Watch(os.Stdout)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		return
+	}
 	fmt.Println(cl.PerformAction(*action, *name))
 }
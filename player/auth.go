@@ -0,0 +1,109 @@
+package player
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Roles of the API tokens. Every role is allowed to do everything the previous ones can
+const (
+	// no token needed
+	rolePublic = iota
+	// can get info about the player, the queue and the playlists
+	roleReadOnly
+	// can control the playback and change the queue
+	roleController
+	// can change the saved playlists
+	roleAdmin
+)
+
+var roleNames = map[int]string{
+	roleReadOnly:   "readonly",
+	roleController: "controller",
+	roleAdmin:      "admin",
+}
+
+// publicPaths can be requested without a token so that clients can check if the service is alive
+// and the web page can load before it is given a token
+var publicPaths = []string{"/", "/css/music_player.css", "/script/music_player.js"}
+
+// parseRole converts the name of a role
+// Returns error if there is no such role
+func parseRole(name string) (int, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+	return rolePublic, errors.New(invalid_role_msg)
+}
+
+// setTokens sets the API tokens and their roles
+// No tokens means every request is allowed
+// Warning: call this before the service starts serving - the tokens are read without locking
+func (player *musicPlayer) setTokens(tokens map[string]string) error {
+	parsed := make(map[string]int)
+	for token, name := range tokens {
+		role, err := parseRole(name)
+		if err != nil {
+			return err
+		}
+		parsed[token] = role
+	}
+	player.tokens = parsed
+	return nil
+}
+
+// requiredRole finds the role a request needs
+func requiredRole(r *http.Request) int {
+	switch {
+	case r.Method == "GET" && contains(publicPaths, r.URL.Path):
+		return rolePublic
+	case r.Method == "GET":
+		return roleReadOnly
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/save/"):
+		return roleAdmin
+	case strings.HasPrefix(r.URL.Path, "/playlists/"):
+		// saved playlists are changed
+		return roleAdmin
+	case r.Method == "POST" && r.URL.Path == "/library/rescan":
+		return roleAdmin
+	}
+	return roleController
+}
+
+// requestToken gets the token from the "Authorization: Bearer <token>" header
+// or from the token query parameter used by the web page
+func requestToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authenticate is a middleware that rejects requests without a token allowed to perform them
+// Responds with 401 if the token is missing or unknown and 403 if its role is not enough
+func (player *musicPlayer) authenticate(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := requiredRole(r)
+		if len(player.tokens) == 0 || required == rolePublic {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		role, ok := player.tokens[requestToken(r)]
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeHttpResponseStatus(w, getResponseContainer(nil, errors.New(unauthorized_msg)),
+				http.StatusUnauthorized)
+			return
+		}
+		if role < required {
+			writeHttpResponseStatus(w, getResponseContainer(nil, errors.New(forbidden_msg)),
+				http.StatusForbidden)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
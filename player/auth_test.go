@@ -0,0 +1,81 @@
+package player
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func initAuthPlayer(t *testing.T) http.Handler {
+	initTestPlayer(t)
+	err := player.setTokens(map[string]string{"adm": "admin", "ctl": "controller", "ro": "readonly"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return player.authenticate(http.HandlerFunc(alive))
+}
+
+func checkStatus(t *testing.T, handler http.Handler, method string, url string, token string, expected int) {
+	request := httptest.NewRequest(method, url, nil)
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != expected {
+		t.Errorf("%s %s with token %q: expected status %d but found %d", method, url, token, expected,
+			recorder.Code)
+	}
+}
+
+func TestAuthenticateMissingToken(t *testing.T) {
+	fmt.Println("TestAuthenticateMissingToken")
+	handler := initAuthPlayer(t)
+	checkStatus(t, handler, "GET", "/", "", http.StatusOK)
+	checkStatus(t, handler, "GET", "/script/music_player.js", "", http.StatusOK)
+	checkStatus(t, handler, "GET", "/songinfo", "", http.StatusUnauthorized)
+	checkStatus(t, handler, "POST", "/pause", "unknown", http.StatusUnauthorized)
+}
+
+func TestAuthenticateRoles(t *testing.T) {
+	fmt.Println("TestAuthenticateRoles")
+	handler := initAuthPlayer(t)
+	checkStatus(t, handler, "GET", "/queueinfo", "ro", http.StatusOK)
+	checkStatus(t, handler, "POST", "/next", "ro", http.StatusForbidden)
+	checkStatus(t, handler, "POST", "/next", "ctl", http.StatusOK)
+	checkStatus(t, handler, "DELETE", "/queue/0", "ctl", http.StatusOK)
+	checkStatus(t, handler, "PUT", "/save/list", "ctl", http.StatusForbidden)
+	checkStatus(t, handler, "PUT", "/save/list", "adm", http.StatusOK)
+	checkStatus(t, handler, "GET", "/library/stats", "ro", http.StatusOK)
+	checkStatus(t, handler, "POST", "/library/rescan", "ctl", http.StatusForbidden)
+	checkStatus(t, handler, "POST", "/library/rescan", "adm", http.StatusOK)
+	checkStatus(t, handler, "GET", "/playlists/list.m3u", "ro", http.StatusOK)
+	checkStatus(t, handler, "DELETE", "/playlists/list.m3u", "ctl", http.StatusForbidden)
+	checkStatus(t, handler, "POST", "/playlists/list.m3u/move/1/0", "ctl", http.StatusForbidden)
+	checkStatus(t, handler, "POST", "/playlists/list.m3u/add/beep9.mp3", "adm", http.StatusOK)
+}
+
+func TestAuthenticateQueryToken(t *testing.T) {
+	fmt.Println("TestAuthenticateQueryToken")
+	handler := initAuthPlayer(t)
+	checkStatus(t, handler, "GET", "/secret?token=ro", "", http.StatusOK)
+	checkStatus(t, handler, "PUT", "/play/beep9.mp3?token=ctl", "", http.StatusOK)
+}
+
+func TestAuthenticateNoTokens(t *testing.T) {
+	fmt.Println("TestAuthenticateNoTokens")
+	initTestPlayer(t)
+	handler := player.authenticate(http.HandlerFunc(alive))
+	checkStatus(t, handler, "PUT", "/save/list", "", http.StatusOK)
+}
+
+func TestSetTokensInvalidRole(t *testing.T) {
+	fmt.Println("TestSetTokensInvalidRole")
+	initTestPlayer(t)
+	err := player.setTokens(map[string]string{"t": "root"})
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, invalid_role_msg, err.Error())
+}
@@ -0,0 +1,247 @@
+package player
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// albumIdPrefix starts the ids of the library albums so that they are not mistaken for file names
+const albumIdPrefix = "album:"
+
+// ArtistInfo describes an artist of the library - the album artist or the artist of the tracks
+type ArtistInfo struct {
+	Name   string
+	Albums int
+	Tracks int
+}
+
+// AlbumInfo describes an album of the library
+// The id can be used to add or play the whole album
+type AlbumInfo struct {
+	Id       string
+	Name     string
+	Artist   string `json:"Artist,omitempty"`
+	Year     string `json:"Year,omitempty"`
+	Tracks   int
+	Duration float64
+}
+
+// GenreInfo describes a genre of the library
+type GenreInfo struct {
+	Name   string
+	Tracks int
+}
+
+// albumId creates the id of an album from its name and artist
+func albumId(key string) string {
+	hash := sha1.Sum([]byte(key))
+	return albumIdPrefix + hex.EncodeToString(hash[:8])
+}
+
+// preferredName picks one of the spellings of a name e.g. of "Tester" and "tester" - always the same one
+func preferredName(name string, other string) string {
+	if len(name) == 0 || other < name {
+		return other
+	}
+	return name
+}
+
+// lessName compares names ignoring the case
+func lessName(a string, b string) bool {
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+// sortAlbumTracks sorts the tracks of an album by disc and track number
+func sortAlbumTracks(tracks []Track) {
+	sort.Slice(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		if a.Track != b.Track {
+			return a.Track < b.Track
+		}
+		if a.Title != b.Title {
+			return lessName(a.Title, b.Title)
+		}
+		return a.Path < b.Path
+	})
+}
+
+// albums groups the tracks of the library by album
+// Returns the albums and their tracks by album id
+func (library *library) albums() (map[string]AlbumInfo, map[string][]Track) {
+	// Warning: never call this if the library is not locked
+	albums := make(map[string]AlbumInfo)
+	tracks := make(map[string][]Track)
+	for _, track := range library.tracks {
+		key := albumKey(track)
+		if len(key) == 0 {
+			continue
+		}
+		id := albumId(key)
+		album, ok := albums[id]
+		if !ok {
+			album = AlbumInfo{Id: id}
+		}
+		album.Name = preferredName(album.Name, track.Album)
+		album.Artist = preferredName(album.Artist, albumArtist(track))
+		if len(album.Year) == 0 || (len(track.Year) > 0 && track.Year < album.Year) {
+			// the year of the earliest track
+			album.Year = track.Year
+		}
+		album.Tracks++
+		album.Duration += track.Duration
+		albums[id] = album
+		tracks[id] = append(tracks[id], track)
+	}
+	return albums, tracks
+}
+
+// albumTracks finds the tracks of an album by its id sorted by disc and track number
+// Returns false if the library has no such album
+func (library *library) albumTracks(id string) ([]Track, bool) {
+	if !strings.HasPrefix(id, albumIdPrefix) {
+		return nil, false
+	}
+	library.Lock()
+	defer library.Unlock()
+	_, tracks := library.albums()
+	albumTracks, ok := tracks[id]
+	if ok {
+		sortAlbumTracks(albumTracks)
+	}
+	return albumTracks, ok
+}
+
+// getArtists lists the artists of the library sorted by name
+// Returns error if the library has no artists
+func (player *musicPlayer) getArtists() ([]ArtistInfo, error) {
+	player.library.Lock()
+	defer player.library.Unlock()
+	albums, _ := player.library.albums()
+	artists := make(map[string]*ArtistInfo)
+	artistOf := func(name string) *ArtistInfo {
+		key := strings.ToLower(name)
+		if _, ok := artists[key]; !ok {
+			artists[key] = &ArtistInfo{}
+		}
+		artists[key].Name = preferredName(artists[key].Name, name)
+		return artists[key]
+	}
+	for _, track := range player.library.tracks {
+		if name := albumArtist(track); len(name) > 0 {
+			artistOf(name).Tracks++
+		}
+	}
+	for _, album := range albums {
+		if len(album.Artist) > 0 {
+			artistOf(album.Artist).Albums++
+		}
+	}
+	if len(artists) == 0 {
+		return nil, errors.New(no_artists_msg)
+	}
+	list := make([]ArtistInfo, 0, len(artists))
+	for _, artist := range artists {
+		list = append(list, *artist)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return lessName(list[i].Name, list[j].Name)
+	})
+	return list, nil
+}
+
+// getArtistAlbums lists the albums of an artist (the name is not case sensitive) by year and name
+// Returns error if the artist has no albums
+func (player *musicPlayer) getArtistAlbums(artist string) ([]AlbumInfo, error) {
+	player.library.Lock()
+	defer player.library.Unlock()
+	albums, _ := player.library.albums()
+	list := make([]AlbumInfo, 0)
+	for _, album := range albums {
+		if strings.EqualFold(album.Artist, artist) {
+			list = append(list, album)
+		}
+	}
+	if len(list) == 0 {
+		return nil, errors.New(artist_not_found_msg)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Year != list[j].Year {
+			return list[i].Year < list[j].Year
+		}
+		return lessName(list[i].Name, list[j].Name)
+	})
+	return list, nil
+}
+
+// getAlbumTracks lists the tracks of an album by disc and track number
+// Returns the file names and the tracks or error if there is no such album
+func (player *musicPlayer) getAlbumTracks(id string) ([]string, []TrackInfo, error) {
+	tracks, ok := player.library.albumTracks(id)
+	if !ok {
+		return nil, nil, errors.New(album_not_found_msg)
+	}
+	names := make([]string, 0, len(tracks))
+	infos := make([]TrackInfo, 0, len(tracks))
+	for _, track := range tracks {
+		names = append(names, track.Path)
+		infos = append(infos, track.info())
+	}
+	return names, infos, nil
+}
+
+// getGenres lists the genres of the library sorted by name
+// Returns error if the library has no genres
+func (player *musicPlayer) getGenres() ([]GenreInfo, error) {
+	player.library.Lock()
+	defer player.library.Unlock()
+	genres := make(map[string]*GenreInfo)
+	for _, track := range player.library.tracks {
+		if len(track.Genre) == 0 {
+			continue
+		}
+		key := strings.ToLower(track.Genre)
+		if _, ok := genres[key]; !ok {
+			genres[key] = &GenreInfo{}
+		}
+		genres[key].Name = preferredName(genres[key].Name, track.Genre)
+		genres[key].Tracks++
+	}
+	if len(genres) == 0 {
+		return nil, errors.New(no_genres_msg)
+	}
+	list := make([]GenreInfo, 0, len(genres))
+	for _, genre := range genres {
+		list = append(list, *genre)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return lessName(list[i].Name, list[j].Name)
+	})
+	return list, nil
+}
+
+// albumEntries returns the tracks of a library album by disc and track number
+// Returns false if there is no such album or error if none of its tracks can be played
+func (player *musicPlayer) albumEntries(id string) ([]playlistEntry, bool, error) {
+	// Warning: never call this if the player is not locked
+	tracks, ok := player.library.albumTracks(id)
+	if !ok {
+		return nil, false, nil
+	}
+	entries := make([]playlistEntry, 0, len(tracks))
+	for _, track := range tracks {
+		// files that are gone or outside the music roots are skipped
+		if player.checkFile(track.Path) == nil {
+			entries = append(entries, playlistEntry{Path: track.Path, Duration: -1})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, true, errors.New(file_not_found_msg)
+	}
+	return entries, true, nil
+}
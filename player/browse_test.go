@@ -0,0 +1,139 @@
+package player
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// initBrowsePlayer creates a player with a library of tracks that are not read from files
+func initBrowsePlayer(t *testing.T, tracks ...Track) {
+	initTestPlayer(t)
+	library := make(map[string]Track)
+	for _, track := range tracks {
+		library[track.Path] = track
+	}
+	player.library.setTracks(library)
+}
+
+func browseTracks() []Track {
+	return []Track{
+		{Path: "/music/a/2-01.mp3", Tags: Tags{Title: "Third", Artist: "Tester", Album: "Beeps", Disc: 2, Track: 1,
+			Year: "2017", Genre: "Noise"}},
+		{Path: "/music/a/1-02.mp3", Tags: Tags{Title: "Second", Artist: "Tester", Album: "Beeps", Disc: 1, Track: 2,
+			Year: "2017", Genre: "noise"}},
+		{Path: "/music/a/1-01.mp3", Tags: Tags{Title: "First", Artist: "tester", Album: "Beeps", Disc: 1, Track: 1,
+			Year: "2016"}},
+		{Path: "/music/b/01.mp3", Tags: Tags{Title: "Early", Artist: "Tester", Album: "Demos", Year: "2010",
+			Genre: "Rock"}},
+		{Path: "/music/c/01.mp3", Tags: Tags{Title: "Guest", Artist: "Beep Band", AlbumArtist: "Various Artists",
+			Album: "Beeps"}},
+		{Path: "/music/d/loose.mp3", Tags: Tags{Title: "Loose", Artist: "Beep Band"}},
+	}
+}
+
+func TestGetArtists(t *testing.T) {
+	fmt.Println("TestGetArtists")
+	initBrowsePlayer(t, browseTracks()...)
+	artists, err := player.getArtists()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// "tester" and "Tester" are the same artist
+	expected := []ArtistInfo{{"Beep Band", 0, 1}, {"Tester", 2, 4}, {"Various Artists", 1, 1}}
+	if !reflect.DeepEqual(expected, artists) {
+		t.Errorf("Expected %v but found %v", expected, artists)
+	}
+
+	initBrowsePlayer(t)
+	_, err = player.getArtists()
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestGetArtistAlbums(t *testing.T) {
+	fmt.Println("TestGetArtistAlbums")
+	initBrowsePlayer(t, browseTracks()...)
+	albums, err := player.getArtistAlbums("TESTER")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkIntFatal(t, 2, len(albums))
+	checkStr(t, "Demos", albums[0].Name)
+	checkStr(t, "Beeps", albums[1].Name)
+	checkStr(t, "2016", albums[1].Year)
+	checkInt(t, 3, albums[1].Tracks)
+	checkStr(t, albumId("beeps\x00tester"), albums[1].Id)
+
+	// the compilation is a different album with the same name
+	albums, err = player.getArtistAlbums("Various Artists")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkIntFatal(t, 1, len(albums))
+	checkInt(t, 1, albums[0].Tracks)
+
+	_, err = player.getArtistAlbums("Nobody")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, artist_not_found_msg, err.Error())
+}
+
+func TestGetAlbumTracks(t *testing.T) {
+	fmt.Println("TestGetAlbumTracks")
+	initBrowsePlayer(t, browseTracks()...)
+	names, tracks, err := player.getAlbumTracks(albumId("beeps\x00tester"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []string{"1-01.mp3", "1-02.mp3", "2-01.mp3"}
+	if !reflect.DeepEqual(expected, filterPath(names)) {
+		t.Errorf("Expected %v but found %v", expected, names)
+	}
+	checkIntFatal(t, 3, len(tracks))
+	checkStr(t, "First", tracks[0].Title)
+	checkStr(t, trackId("/music/a/2-01.mp3"), tracks[2].Id)
+
+	_, _, err = player.getAlbumTracks(albumIdPrefix + "0000000000000000")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, album_not_found_msg, err.Error())
+}
+
+func TestGetGenres(t *testing.T) {
+	fmt.Println("TestGetGenres")
+	initBrowsePlayer(t, browseTracks()...)
+	genres, err := player.getGenres()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkIntFatal(t, 2, len(genres))
+	checkStr(t, "Noise", genres[0].Name)
+	checkInt(t, 2, genres[0].Tracks)
+	checkStr(t, "Rock", genres[1].Name)
+	checkInt(t, 1, genres[1].Tracks)
+}
+
+func TestAddAlbum(t *testing.T) {
+	fmt.Println("TestAddAlbum")
+	first, _ := filepath.Abs("test_sounds/beep28.mp3")
+	second, _ := filepath.Abs("test_sounds/beep9.mp3")
+	initBrowsePlayer(t,
+		Track{Path: second, Tags: Tags{Title: "Short", Album: "Beeps", Artist: "Tester", Track: 2}},
+		Track{Path: first, Tags: Tags{Title: "Long", Album: "Beeps", Artist: "Tester", Track: 1}})
+
+	player.Lock()
+	items, err := player.addPlayItem(albumId("beeps\x00tester"))
+	player.Unlock()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual([]string{first, second}, items) {
+		t.Errorf("Expected the album in track order but found %v", items)
+	}
+	checkQueue(t, []string{first, second})
+}
@@ -0,0 +1,286 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the music_player web service
+// Settings are read from a json config file, then from MUSIC_PLAYER_* environment variables
+// and then from command line flags, each one overriding the previous
+type Config struct {
+	// Address to bind to. Empty for all interfaces
+	Address string
+	// Port to listen on
+	Port int
+	// Port to listen on for MPD clients. 0 to disable
+	MPDPort int
+	// Directory where the playlists are saved
+	PlaylistsDir string
+	// Directories music can be played from
+	MusicRoots []string
+	// Output sink (see NewOutputSink)
+	Output string
+	// File the player state is saved to. Empty to disable
+	StateFile string
+	// File the library index is saved to. Empty to scan the music roots from scratch on every start
+	LibraryFile string
+	// Seconds between scans of the music roots. They find the changes that are not watched e.g. on NFS or SMB
+	LibraryPollInterval int
+	// Serve HTTPS instead of HTTP
+	TLS bool
+	// PEM encoded certificate and key for HTTPS. A self-signed pair is generated if neither exists
+	CertFile string
+	KeyFile  string
+	// API tokens and their roles (readonly, controller or admin). No tokens means no authentication
+	Tokens map[string]string
+}
+
+// environment variables that override the config file
+const (
+	envConfig       = "MUSIC_PLAYER_CONFIG"
+	envAddress      = "MUSIC_PLAYER_ADDRESS"
+	envPort         = "MUSIC_PLAYER_PORT"
+	envMPDPort      = "MUSIC_PLAYER_MPD_PORT"
+	envPlaylistsDir = "MUSIC_PLAYER_PLAYLISTS_DIR"
+	envMusicRoots   = "MUSIC_PLAYER_MUSIC_ROOTS"
+	envOutput       = "MUSIC_PLAYER_OUTPUT"
+	envStateFile    = "MUSIC_PLAYER_STATE_FILE"
+	envLibraryFile  = "MUSIC_PLAYER_LIBRARY_FILE"
+	envLibraryPoll  = "MUSIC_PLAYER_LIBRARY_POLL_INTERVAL"
+	envTokens       = "MUSIC_PLAYER_TOKENS"
+	envTLS          = "MUSIC_PLAYER_TLS"
+	envCertFile     = "MUSIC_PLAYER_CERT_FILE"
+	envKeyFile      = "MUSIC_PLAYER_KEY_FILE"
+)
+
+// DefaultConfig returns the settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		Port:                8765,
+		PlaylistsDir:        getPlaylistDir(),
+		Output:              "auto",
+		StateFile:           "music_player_state.json",
+		LibraryFile:         "music_player_library.json",
+		LibraryPollInterval: 300,
+		CertFile:            "music_player_cert.pem",
+		KeyFile:             "music_player_key.pem",
+	}
+}
+
+// ConfigFile returns the path of the config file from MUSIC_PLAYER_CONFIG or empty string if not set
+func ConfigFile() string {
+	return os.Getenv(envConfig)
+}
+
+// LoadConfig reads the config file on top of the default settings
+// Settings missing in the file keep their default values. Empty path means no config file
+// Returns error if the file cannot be read or is not valid json
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	if len(path) == 0 {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("cannot read config file %s: %s", path, err.Error())
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("invalid config file %s: %s", path, err.Error())
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides the settings with the MUSIC_PLAYER_* environment variables that are set
+// MUSIC_PLAYER_MUSIC_ROOTS is a list separated like PATH
+// MUSIC_PLAYER_TOKENS is a comma separated list of token:role
+// Returns error if a variable has an invalid value
+func (config *Config) ApplyEnv() error {
+	if value, ok := os.LookupEnv(envAddress); ok {
+		config.Address = value
+	}
+	if value, ok := os.LookupEnv(envPort); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, found %q", envPort, value)
+		}
+		config.Port = port
+	}
+	if value, ok := os.LookupEnv(envMPDPort); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, found %q", envMPDPort, value)
+		}
+		config.MPDPort = port
+	}
+	if value, ok := os.LookupEnv(envPlaylistsDir); ok {
+		config.PlaylistsDir = value
+	}
+	if value, ok := os.LookupEnv(envMusicRoots); ok {
+		config.MusicRoots = SplitMusicRoots(value)
+	}
+	if value, ok := os.LookupEnv(envOutput); ok {
+		config.Output = value
+	}
+	if value, ok := os.LookupEnv(envStateFile); ok {
+		config.StateFile = value
+	}
+	if value, ok := os.LookupEnv(envLibraryFile); ok {
+		config.LibraryFile = value
+	}
+	if value, ok := os.LookupEnv(envLibraryPoll); ok {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, found %q", envLibraryPoll, value)
+		}
+		config.LibraryPollInterval = seconds
+	}
+	if value, ok := os.LookupEnv(envTLS); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, found %q", envTLS, value)
+		}
+		config.TLS = enabled
+	}
+	if value, ok := os.LookupEnv(envCertFile); ok {
+		config.CertFile = value
+	}
+	if value, ok := os.LookupEnv(envKeyFile); ok {
+		config.KeyFile = value
+	}
+	if value, ok := os.LookupEnv(envTokens); ok {
+		tokens, err := ParseTokens(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s", envTokens, err.Error())
+		}
+		config.Tokens = tokens
+	}
+	return nil
+}
+
+// ParseTokens parses a comma separated list of token:role e.g. "s3cret:admin,kitchen:controller"
+// Returns error if an element has no role
+func ParseTokens(list string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, element := range strings.Split(list, ",") {
+		element = strings.TrimSpace(element)
+		if len(element) == 0 {
+			continue
+		}
+		i := strings.LastIndex(element, ":")
+		if i <= 0 {
+			return tokens, fmt.Errorf("token must be followed by :role, found %q", element)
+		}
+		tokens[element[:i]] = element[i+1:]
+	}
+	return tokens, nil
+}
+
+// SplitMusicRoots splits a list of directories separated like PATH
+func SplitMusicRoots(list string) []string {
+	roots := make([]string, 0)
+	for _, root := range filepath.SplitList(list) {
+		if len(root) > 0 {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// ListenAddress returns the address the web service listens on e.g. ":8765" or "127.0.0.1:8765"
+func (config *Config) ListenAddress() string {
+	return net.JoinHostPort(config.Address, strconv.Itoa(config.Port))
+}
+
+// LibraryPoll returns how often the music roots are scanned besides watching them
+func (config *Config) LibraryPoll() time.Duration {
+	return time.Duration(config.LibraryPollInterval) * time.Second
+}
+
+// MPDAddress returns the address the MPD server listens on e.g. ":6600"
+func (config *Config) MPDAddress() string {
+	return net.JoinHostPort(config.Address, strconv.Itoa(config.MPDPort))
+}
+
+// Validate checks the settings and normalises the directories
+// Playlists directory ends with a slash and music roots become absolute
+// Returns error describing the first invalid setting
+func (config *Config) Validate() error {
+	if config.Port < 1 || config.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, found %d", config.Port)
+	}
+	if config.MPDPort < 0 || config.MPDPort > 65535 {
+		return fmt.Errorf("MPD port must be between 1 and 65535 or 0 to disable, found %d", config.MPDPort)
+	}
+	if config.MPDPort == config.Port {
+		return fmt.Errorf("MPD port must differ from port %d", config.Port)
+	}
+	if len(config.Address) > 0 && net.ParseIP(config.Address) == nil {
+		if _, err := net.LookupHost(config.Address); err != nil {
+			return fmt.Errorf("cannot resolve address %q", config.Address)
+		}
+	}
+
+	if len(config.PlaylistsDir) == 0 {
+		return fmt.Errorf("playlists directory must be set")
+	}
+	// the directory is created on the first save if it does not exist
+	if fileInfo, err := os.Stat(config.PlaylistsDir); err == nil && !fileInfo.IsDir() {
+		return fmt.Errorf("playlists directory %s is not a directory", config.PlaylistsDir)
+	}
+	if !strings.HasSuffix(config.PlaylistsDir, "/") {
+		config.PlaylistsDir = config.PlaylistsDir + "/"
+	}
+
+	for i, root := range config.MusicRoots {
+		fileInfo, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("music root %s cannot be found", root)
+		}
+		if !fileInfo.IsDir() {
+			return fmt.Errorf("music root %s is not a directory", root)
+		}
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return fmt.Errorf("music root %s cannot be resolved", root)
+		}
+		config.MusicRoots[i] = absRoot
+	}
+
+	if len(config.MusicRoots) > 0 && config.LibraryPollInterval < 1 {
+		return fmt.Errorf("library poll interval must be at least 1 second, found %d", config.LibraryPollInterval)
+	}
+
+	if _, err := NewOutputSink(config.Output); err != nil {
+		return fmt.Errorf("invalid output %q: %s", config.Output, err.Error())
+	}
+
+	if config.TLS {
+		if len(config.CertFile) == 0 || len(config.KeyFile) == 0 {
+			return fmt.Errorf("certificate and key files must be set for TLS")
+		}
+		// both are generated if none exists, but a single one cannot be completed
+		if fileExists(config.CertFile) != fileExists(config.KeyFile) {
+			return fmt.Errorf("both or none of certificate %s and key %s must exist",
+				config.CertFile, config.KeyFile)
+		}
+	}
+
+	for token, role := range config.Tokens {
+		if len(token) == 0 {
+			return fmt.Errorf("tokens cannot be empty")
+		}
+		if _, err := parseRole(role); err != nil {
+			return fmt.Errorf("%s, found %q", err.Error(), role)
+		}
+	}
+	return nil
+}
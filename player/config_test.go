@@ -0,0 +1,117 @@
+package player
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfigFile = "test_config.json"
+
+func TestLoadConfig(t *testing.T) {
+	fmt.Println("TestLoadConfig")
+	defer os.Remove(testConfigFile)
+	ioutil.WriteFile(testConfigFile, []byte(`{"Port": 9000, "MusicRoots": ["test_sounds"], "Output": "null"}`), 0666)
+	config, err := LoadConfig(testConfigFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkInt(t, 9000, config.Port)
+	checkStr(t, "null", config.Output)
+	checkStr(t, "music_player_state.json", config.StateFile)
+	checkStr(t, ":9000", config.ListenAddress())
+	if !reflect.DeepEqual([]string{"test_sounds"}, config.MusicRoots) {
+		t.Errorf("Expected\n---\n[test_sounds]\n---\nbut found\n---\n%v\n---\n", config.MusicRoots)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	fmt.Println("TestLoadConfigInvalid")
+	defer os.Remove(testConfigFile)
+	ioutil.WriteFile(testConfigFile, []byte(`{"Port": "abc"}`), 0666)
+	_, err := LoadConfig(testConfigFile)
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+	_, err = LoadConfig("no_such_config.json")
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	fmt.Println("TestApplyEnv")
+	os.Setenv(envPort, "9001")
+	os.Setenv(envMusicRoots, "test_sounds"+string(os.PathListSeparator)+"test_broken")
+	defer os.Unsetenv(envPort)
+	defer os.Unsetenv(envMusicRoots)
+	config := DefaultConfig()
+	err := config.ApplyEnv()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkInt(t, 9001, config.Port)
+	checkInt(t, 2, len(config.MusicRoots))
+
+	os.Setenv(envPort, "abc")
+	err = config.ApplyEnv()
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	fmt.Println("TestValidateConfig")
+	config := DefaultConfig()
+	config.PlaylistsDir = "test_playlists"
+	config.MusicRoots = []string{"test_sounds"}
+	err := config.Validate()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "test_playlists/", config.PlaylistsDir)
+	absRoot, _ := filepath.Abs("test_sounds")
+	checkStr(t, absRoot, config.MusicRoots[0])
+}
+
+func TestValidateConfigInvalid(t *testing.T) {
+	fmt.Println("TestValidateConfigInvalid")
+	configs := map[string]Config{
+		"port":      {Port: 70000, PlaylistsDir: "playlists/", Output: "auto"},
+		"playlists": {Port: 8765, PlaylistsDir: "test_sounds/beep9.mp3", Output: "auto"},
+		"root":      {Port: 8765, PlaylistsDir: "playlists/", MusicRoots: []string{"no_such_dir"}, Output: "auto"},
+		"root file": {Port: 8765, PlaylistsDir: "playlists/", MusicRoots: []string{"test_sounds/beep9.mp3"}},
+		"output":    {Port: 8765, PlaylistsDir: "playlists/", Output: "speaker"},
+		"poll":      {Port: 8765, PlaylistsDir: "playlists/", MusicRoots: []string{"test_sounds"}, Output: "auto"},
+	}
+	for name, config := range configs {
+		if err := config.Validate(); err == nil {
+			t.Errorf("Expected error for invalid %s", name)
+		}
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	fmt.Println("TestParseTokens")
+	tokens, err := ParseTokens("s3cret:admin, kitchen:controller,,guest:readonly")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := map[string]string{"s3cret": "admin", "kitchen": "controller", "guest": "readonly"}
+	if !reflect.DeepEqual(expected, tokens) {
+		t.Errorf("Expected\n---\n%v\n---\nbut found\n---\n%v\n---\n", expected, tokens)
+	}
+	_, err = ParseTokens("s3cret")
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+
+	config := DefaultConfig()
+	config.Tokens = map[string]string{"s3cret": "root"}
+	if config.Validate() == nil {
+		t.Errorf("Error expected")
+	}
+}
@@ -0,0 +1,128 @@
+package player
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/krig/go-sox"
+)
+
+// maxCrossfade is the longest overlap of two songs in seconds
+const maxCrossfade = 30
+
+// parseCrossfade converts the crossfade in seconds ("5", "2.5", "0" turns it off)
+// Returns error if it is not a number between 0 and maxCrossfade
+func parseCrossfade(seconds string) (float64, error) {
+	value, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || math.IsNaN(value) || value < 0 || value > maxCrossfade {
+		return 0, errors.New(invalid_crossfade_msg)
+	}
+	return value, nil
+}
+
+// setCrossfade sets how many seconds a song fades out while the following song fades in
+// The change is heard from the next song on
+// Returns the modes or error if the crossfade is invalid
+func (player *musicPlayer) setCrossfade(seconds string) (ModeInfo, error) {
+	value, err := parseCrossfade(seconds)
+	player.Lock()
+	defer player.Unlock()
+	if err != nil {
+		return player.modeInfo(), err
+	}
+	player.state.crossfade = value
+	player.stateChanged()
+	return player.modeInfo(), nil
+}
+
+// crossfadeLength returns the crossfade songs are played with or 0 if the output cannot play two songs at once
+// e.g. a file or an alsa hw device that the following song cannot open while the fading song plays to it
+func (player *musicPlayer) crossfadeLength() float64 {
+	// Warning: never call this if the player is not locked
+	if !sharedOutput(player.outputSink()) {
+		return 0
+	}
+	return player.state.crossfade
+}
+
+// fadeOptions returns the options of the sox fade effect for a song of length seconds
+// The song fades in if fadeIn is set and fades out at its end if it is long enough for both
+// Returns nil if the song does not fade
+func fadeOptions(length float64, crossfade float64, fadeIn bool) []interface{} {
+	if crossfade <= 0 || length <= crossfade {
+		return nil
+	}
+	fadeLength := strconv.FormatFloat(crossfade, 'f', 2, 64)
+	fadeInLength := "0"
+	if fadeIn {
+		fadeInLength = fadeLength
+	}
+	if length <= 2*crossfade {
+		if !fadeIn {
+			return nil
+		}
+		return []interface{}{"t", fadeInLength}
+	}
+	// the fade out ends at the end of the song
+	return []interface{}{"t", fadeInLength, strconv.FormatFloat(length, 'f', 2, 64), fadeLength}
+}
+
+// fadesOut checks if the fade options make the song fade out
+func fadesOut(options []interface{}) bool {
+	return len(options) == 4
+}
+
+// startFading lets the chain of the current song play its end in the background
+// so that the following song can start. Nothing fades if the song was paused or stopped
+// or the queue is finished
+// Returns true if the song fades out
+func (player *musicPlayer) startFading(chain *sox.EffectsChain, done chan struct{}) bool {
+	player.Lock()
+	defer player.Unlock()
+	if player.state.chain != chain || player.state.status != playing {
+		return false
+	}
+	if _, ok := player.followingIndex(false); !ok {
+		return false
+	}
+	player.stopFading()
+	player.state.fading = chain
+	player.state.fadingDone = done
+	player.state.chain = nil
+	player.state.status = waiting
+	return true
+}
+
+// stopFading stops the song that fades out at once
+func (player *musicPlayer) stopFading() {
+	// Warning: never call this if the player is not locked
+	if player.state.fading != nil {
+		player.state.fading.DeleteAll()
+		player.state.fading = nil
+	}
+}
+
+// endFading stops the song that fades out and waits until its output is released
+// Returns false if no song was fading out
+func (player *musicPlayer) endFading() bool {
+	player.Lock()
+	done := player.state.fadingDone
+	player.stopFading()
+	player.Unlock()
+	if done == nil {
+		return false
+	}
+	<-done
+	return true
+}
+
+// waitFading waits until the song that fades out ends
+func (player *musicPlayer) waitFading() {
+	player.Lock()
+	done := player.state.fadingDone
+	player.Unlock()
+	if done != nil {
+		<-done
+	}
+}
@@ -0,0 +1,128 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/krig/go-sox"
+)
+
+func TestParseCrossfade(t *testing.T) {
+	fmt.Println("TestParseCrossfade")
+	for seconds, expected := range map[string]float64{"0": 0, "5": 5, "2.5": 2.5, "30": 30} {
+		found, err := parseCrossfade(seconds)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", seconds, err.Error())
+		}
+		checkDuration(t, expected, expected, found)
+	}
+	for _, seconds := range []string{"", "-1", "31", "five", "NaN"} {
+		_, err := parseCrossfade(seconds)
+		if err == nil {
+			t.Errorf("Expected error for %q", seconds)
+			continue
+		}
+		checkStr(t, invalid_crossfade_msg, err.Error())
+	}
+}
+
+func TestFadeOptions(t *testing.T) {
+	fmt.Println("TestFadeOptions")
+	check := func(expected []interface{}, found []interface{}) {
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("Expected\n---\n%v\n---\nbut found\n---\n%v\n---\n", expected, found)
+		}
+	}
+	check(nil, fadeOptions(120, 0, true))
+	check([]interface{}{"t", "0", "120.00", "5.00"}, fadeOptions(120, 5, false))
+	check([]interface{}{"t", "5.00", "120.00", "5.00"}, fadeOptions(120, 5, true))
+	// too short to fade out as well
+	check(nil, fadeOptions(8, 5, false))
+	check([]interface{}{"t", "5.00"}, fadeOptions(8, 5, true))
+	check(nil, fadeOptions(3, 5, true))
+	if !fadesOut(fadeOptions(120, 5, false)) || fadesOut(fadeOptions(8, 5, true)) {
+		t.Errorf("Expected only the long song to fade out")
+	}
+}
+
+func TestSetCrossfade(t *testing.T) {
+	fmt.Println("TestSetCrossfade")
+	initTestPlayer(t)
+	ch := player.subscribe()
+	info, err := player.setCrossfade("4.5")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkDuration(t, 4.5, 4.5, info.Crossfade)
+	event := checkEvent(t, ch, eventMode)
+	checkDuration(t, 4.5, 4.5, event.Info.(ModeInfo).Crossfade)
+
+	data, _ := json.Marshal(info)
+	checkStr(t, `{"Repeat":"off","Shuffle":false,"Crossfade":4.5}`, string(data))
+
+	_, err = player.setCrossfade("45")
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	checkDuration(t, 4.5, 4.5, player.state.crossfade)
+	checkNoEvent(t, ch)
+
+	info, _ = player.setCrossfade("0")
+	data, _ = json.Marshal(info)
+	checkStr(t, `{"Repeat":"off","Shuffle":false}`, string(data))
+}
+
+func TestCrossfadeFileSink(t *testing.T) {
+	fmt.Println("TestCrossfadeFileSink")
+	initTestPlayer(t)
+	player.state.crossfade = 5
+	checkDuration(t, 5, 5, player.crossfadeLength())
+	player.output = fileSink{fileType: "wav", path: "out.wav"}
+	checkDuration(t, 0, 0, player.crossfadeLength())
+	checkDuration(t, 0, 0, player.modeInfo().Crossfade)
+	// the device cannot be opened by the following song while the fading song plays to it
+	player.output = deviceSink{deviceType: "alsa", device: "hw:1,0"}
+	checkDuration(t, 0, 0, player.crossfadeLength())
+	player.output = deviceSink{deviceType: "alsa", device: "default"}
+	checkDuration(t, 5, 5, player.crossfadeLength())
+}
+
+func TestStartFading(t *testing.T) {
+	fmt.Println("TestStartFading")
+	initTestPlayer(t)
+	player.state.queue = []string{"a.mp3", "b.mp3", "c.mp3", "d.mp3"}
+	chain := &sox.EffectsChain{}
+	done := make(chan struct{})
+	player.state.chain = chain
+	player.state.status = playing
+
+	player.state.current = 3
+	if player.startFading(chain, done) {
+		t.Errorf("Expected the last song not to fade out")
+	}
+	player.state.current = 1
+	player.state.status = paused
+	if player.startFading(chain, done) {
+		t.Errorf("Expected the paused song not to fade out")
+	}
+	player.state.status = playing
+	player.state.chain = nil
+	if player.startFading(chain, done) {
+		t.Errorf("Expected a stopped song not to fade out")
+	}
+
+	player.state.chain = chain
+	if !player.startFading(chain, done) {
+		t.Fatalf("Expected the song to fade out")
+	}
+	checkInt(t, waiting, player.state.status)
+	if player.state.chain != nil || player.state.fading != chain || player.state.fadingDone != done {
+		t.Errorf("Expected the chain to be fading")
+	}
+	// the chain is not real, so it is not stopped
+	player.state.fading = nil
+	close(done)
+	player.waitEnd()
+}
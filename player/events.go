@@ -0,0 +1,213 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Types of the events sent to the subscribers
+const (
+	// a song starts playing - a new song, a resumed one or after seek
+	eventPlaying = "playing"
+	eventPaused  = "paused"
+	// nothing is playing any more - stopped or the end of the queue is reached
+	eventStopped = "stopped"
+	// songs are added, removed or moved or the shuffled order changes
+	eventQueue  = "queue"
+	eventVolume = "volume"
+	eventMode   = "mode"
+	// a song cannot be played
+	eventError = "error"
+	// a library scan finished
+	eventLibrary = "library"
+	// songs of the queue are gone from the disk and are removed from it
+	eventMissing = "missing"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before events are dropped for it
+const subscriberBuffer = 64
+
+// eventsKeepAlive is how often a comment is sent on an idle event stream so that proxies keep it open
+const eventsKeepAlive = 30 * time.Second
+
+// Event describes a change of the player's state
+// It has the type of the change, error message for errors, file names and structured info like the responses
+type Event struct {
+	Type    string
+	Message string      `json:"Message,omitempty"`
+	Data    []string    `json:"Data,omitempty"`
+	Info    interface{} `json:"Info,omitempty"`
+}
+
+// eventBus delivers the events of the player to all subscribers
+// A subscriber that does not keep up misses events instead of blocking the player
+type eventBus struct {
+	sync.Mutex
+	subscribers map[chan Event]bool
+	closed      bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan Event]bool)}
+}
+
+// subscribe returns a channel receiving all events from now on
+// The channel is closed when the bus is closed
+func (bus *eventBus) subscribe() chan Event {
+	bus.Lock()
+	defer bus.Unlock()
+	ch := make(chan Event, subscriberBuffer)
+	if bus.closed {
+		close(ch)
+		return ch
+	}
+	bus.subscribers[ch] = true
+	return ch
+}
+
+// unsubscribe stops sending events to the channel
+func (bus *eventBus) unsubscribe(ch chan Event) {
+	bus.Lock()
+	defer bus.Unlock()
+	if bus.subscribers[ch] {
+		delete(bus.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends the event to all subscribers without waiting for them
+func (bus *eventBus) publish(event Event) {
+	bus.Lock()
+	defer bus.Unlock()
+	for ch := range bus.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close closes the channels of all subscribers so that event streams end
+func (bus *eventBus) close() {
+	bus.Lock()
+	defer bus.Unlock()
+	for ch := range bus.subscribers {
+		close(ch)
+	}
+	bus.subscribers = make(map[chan Event]bool)
+	bus.closed = true
+}
+
+// subscribe returns a channel receiving the events of the player
+func (player *musicPlayer) subscribe() chan Event {
+	return player.events.subscribe()
+}
+
+// unsubscribe stops sending the events of the player to the channel
+func (player *musicPlayer) unsubscribe(ch chan Event) {
+	player.events.unsubscribe(ch)
+}
+
+// closeEvents ends all event streams
+func (player *musicPlayer) closeEvents() {
+	player.events.close()
+}
+
+// publish sends an event to the subscribers. The file names are sent without path like in the responses
+func (player *musicPlayer) publish(event Event) {
+	if player.events == nil {
+		return
+	}
+	if event.Data != nil {
+		event.Data = filterPath(event.Data)
+	}
+	player.events.publish(event)
+}
+
+// publishSong sends an event about the current song
+func (player *musicPlayer) publishSong(eventType string) {
+	// Warning: never call this if the player is not locked
+	info, err := player.songInfo()
+	if err != nil {
+		player.publish(Event{Type: eventType})
+		return
+	}
+	// the subscribers get the name of the song without the directories like songinfo returns it
+	info.Name = filterPath([]string{info.Name})[0]
+	player.publish(Event{Type: eventType, Data: []string{info.Name}, Info: info})
+}
+
+// publishChanges sends events for the parts of the state that changed since the last call
+// i.e. the queue, the volume and the modes
+func (player *musicPlayer) publishChanges() {
+	// Warning: never call this if the player is not locked
+	current := player.snapshot()
+	previous := player.published
+	player.published = current
+
+	if !reflect.DeepEqual(previous.Queue, current.Queue) || !reflect.DeepEqual(previous.Order, current.Order) {
+		songs, info, _ := player.queueDetails()
+		player.publish(Event{Type: eventQueue, Data: songs, Info: info})
+	}
+	if previous.Volume != current.Volume || previous.Muted != current.Muted {
+		player.publish(Event{Type: eventVolume, Info: player.volumeInfo()})
+	}
+	if previous.Repeat != current.Repeat || previous.Shuffle != current.Shuffle ||
+		previous.Crossfade != current.Crossfade {
+		player.publish(Event{Type: eventMode, Info: player.modeInfo()})
+	}
+}
+
+// writeEvent writes an event in the server-sent events format
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// streamEvents sends the events of the player as server-sent events until the client goes away
+// or the service shuts down
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := player.subscribe()
+	defer player.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if writeEvent(w, event) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,110 @@
+package player
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func initEventsPlayer(t *testing.T) chan Event {
+	initTestPlayer(t)
+	return player.subscribe()
+}
+
+func checkEvent(t *testing.T, ch chan Event, expectedType string) Event {
+	select {
+	case event := <-ch:
+		checkStr(t, expectedType, event.Type)
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("Expected %s event", expectedType)
+	}
+	return Event{}
+}
+
+func checkNoEvent(t *testing.T, ch chan Event) {
+	select {
+	case event := <-ch:
+		t.Errorf("Unexpected %s event", event.Type)
+	default:
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	fmt.Println("TestEventBus")
+	bus := newEventBus()
+	first := bus.subscribe()
+	second := bus.subscribe()
+	bus.publish(Event{Type: eventStopped})
+	checkEvent(t, first, eventStopped)
+	checkEvent(t, second, eventStopped)
+
+	bus.unsubscribe(first)
+	bus.publish(Event{Type: eventPaused})
+	checkEvent(t, second, eventPaused)
+	if _, ok := <-first; ok {
+		t.Errorf("Expected the channel to be closed")
+	}
+
+	bus.close()
+	if _, ok := <-second; ok {
+		t.Errorf("Expected the channel to be closed")
+	}
+	if _, ok := <-bus.subscribe(); ok {
+		t.Errorf("Expected the channel to be closed")
+	}
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	fmt.Println("TestEventBusSlowSubscriber")
+	bus := newEventBus()
+	ch := bus.subscribe()
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.publish(Event{Type: eventQueue})
+	}
+	checkInt(t, subscriberBuffer, len(ch))
+}
+
+func TestEventsForChanges(t *testing.T) {
+	fmt.Println("TestEventsForChanges")
+	ch := initEventsPlayer(t)
+
+	player.setRepeat("all")
+	event := checkEvent(t, ch, eventMode)
+	checkStr(t, "all", event.Info.(ModeInfo).Repeat)
+
+	player.setVolume("50")
+	event = checkEvent(t, ch, eventVolume)
+	checkFloat(t, 50, event.Info.(VolumeInfo).Percent)
+
+	// setting the same mode again changes nothing
+	player.setRepeat("all")
+	checkNoEvent(t, ch)
+
+	player.Lock()
+	player.state.queue = []string{"test_sounds/beep9.mp3", "test_sounds/beep28.mp3"}
+	player.state.status = paused
+	player.stateChanged()
+	player.Unlock()
+	event = checkEvent(t, ch, eventQueue)
+	checkStr(t, "beep9.mp3", event.Data[0])
+
+	player.moveSong("0", "1")
+	event = checkEvent(t, ch, eventQueue)
+	checkStr(t, "beep28.mp3", event.Data[0])
+	checkNoEvent(t, ch)
+}
+
+func TestEventsForStop(t *testing.T) {
+	fmt.Println("TestEventsForStop")
+	ch := initEventsPlayer(t)
+	player.Lock()
+	player.state.queue = []string{"test_sounds/beep9.mp3"}
+	player.stateChanged()
+	player.Unlock()
+	checkEvent(t, ch, eventQueue)
+
+	player.stop()
+	checkEvent(t, ch, eventStopped)
+	checkEvent(t, ch, eventQueue)
+}
@@ -0,0 +1,220 @@
+package player
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/krig/go-sox"
+)
+
+// outputIdleTime is how long the output stays open when no song is played to it
+// e.g. after pause or at the end of the queue
+const outputIdleTime = 2 * time.Second
+
+// maxDecodeLength is the longest song in seconds that is decoded in advance
+// Longer songs are only opened, so that their samples do not fill the disk
+const maxDecodeLength = 20 * 60
+
+// preparedSong is the following song that is opened and decoded while the current one plays
+type preparedSong struct {
+	path string
+	in   *sox.Format
+}
+
+// prepareFollowing opens the song to be played after the current one and decodes it,
+// so that it starts without waiting for the decoder when the current song ends
+// The song is forgotten if the queue changes in the meantime
+func (player *musicPlayer) prepareFollowing() {
+	player.Lock()
+	index, ok := player.followingIndex(false)
+	if !ok || player.state.prepared != nil {
+		player.Unlock()
+		return
+	}
+	path := player.state.queue[index]
+	player.Unlock()
+
+	in := sox.OpenRead(path)
+	if in == nil {
+		// the error is reported when the song is played
+		return
+	}
+	if length := signalDuration(in.Signal()).Seconds(); length > 0 && length <= maxDecodeLength {
+		in = player.decode(in)
+		if in == nil {
+			return
+		}
+	}
+	player.Lock()
+	index, ok = player.followingIndex(false)
+	if ok && player.state.queue[index] == path && player.state.prepared == nil {
+		player.state.prepared = &preparedSong{path: path, in: in}
+		in = nil
+	}
+	player.Unlock()
+	if in != nil {
+		in.Release()
+	}
+}
+
+// decode decodes an opened song to a temporary wav file and opens the file instead of the song
+// The file is deleted as soon as it is opened
+// Returns the song itself if it cannot be decoded or nil if the decoding was stopped
+func (player *musicPlayer) decode(in *sox.Format) *sox.Format {
+	file, err := ioutil.TempFile("", "music_player_*.wav")
+	if err != nil {
+		return in
+	}
+	path := file.Name()
+	file.Close()
+	defer os.Remove(path)
+	out := sox.OpenWrite(path, in.Signal(), nil, "wav")
+	if out == nil {
+		return in
+	}
+
+	chain := sox.CreateEffectsChain(in.Encoding(), out.Encoding())
+	e := sox.CreateEffect(sox.FindEffect("input"))
+	e.Options(in)
+	chain.Add(e, in.Signal(), in.Signal())
+	e.Release()
+	e = sox.CreateEffect(sox.FindEffect("output"))
+	e.Options(out)
+	chain.Add(e, in.Signal(), in.Signal())
+	e.Release()
+
+	done := make(chan struct{})
+	defer close(done)
+	player.Lock()
+	// only the latest following song is decoded
+	player.stopDecoding()
+	player.state.decoding = chain
+	player.state.decodingDone = done
+	player.Unlock()
+
+	chain.Flow()
+	player.Lock()
+	stopped := player.state.decoding != chain
+	if !stopped {
+		player.state.decoding = nil
+		player.state.decodingDone = nil
+	}
+	player.Unlock()
+	chain.Release()
+	out.Release()
+	in.Release()
+	if stopped {
+		return nil
+	}
+	// the samples can be read from the open file after it is deleted
+	return sox.OpenRead(path)
+}
+
+// stopDecoding stops decoding the following song at once
+func (player *musicPlayer) stopDecoding() {
+	// Warning: never call this if the player is not locked
+	if player.state.decoding != nil {
+		player.state.decoding.DeleteAll()
+		player.state.decoding = nil
+		player.state.decodingDone = nil
+	}
+}
+
+// openInput returns the prepared song if it is the requested one or opens the file
+// A song that is still being decoded is opened again, as it is needed now
+// Returns nil if the file could not be opened
+func (player *musicPlayer) openInput(filename string) *sox.Format {
+	player.Lock()
+	prepared := player.state.prepared
+	player.state.prepared = nil
+	player.stopDecoding()
+	player.Unlock()
+	if prepared != nil {
+		if prepared.path == filename {
+			return prepared.in
+		}
+		prepared.in.Release()
+	}
+	return sox.OpenRead(filename)
+}
+
+// openOutput returns the output kept open by the previous song if it has the same channels
+// Otherwise a new output is opened with the signal of the song
+// Returns nil if the output could not be opened
+func (player *musicPlayer) openOutput(signal *sox.SignalInfo) *sox.Format {
+	player.Lock()
+	out := player.state.output
+	player.state.output = nil
+	player.Unlock()
+	if out != nil {
+		if out.Signal().Channels() == signal.Channels() {
+			return out
+		}
+		out.Release()
+	}
+	return player.outputSink().Open(signal)
+}
+
+// keepOutput keeps the output of a song that ended open for the following song
+// The output is released if it is not used within outputIdleTime
+// Returns false if another output is already kept
+func (player *musicPlayer) keepOutput(out *sox.Format) bool {
+	// Warning: never call this if the player is not locked
+	if player.state.output != nil {
+		return false
+	}
+	player.state.output = out
+	player.state.outputKept++
+	kept := player.state.outputKept
+	time.AfterFunc(outputIdleTime, func() {
+		player.Lock()
+		if player.state.output != out || player.state.outputKept != kept {
+			// the output is used again
+			player.Unlock()
+			return
+		}
+		player.state.output = nil
+		player.Unlock()
+		out.Release()
+	})
+	return true
+}
+
+// releaseOutput releases the kept output and the prepared song at once
+// and waits until the song that is being decoded is released
+func (player *musicPlayer) releaseOutput() {
+	player.Lock()
+	out := player.state.output
+	player.state.output = nil
+	done := player.state.decodingDone
+	player.releasePrepared()
+	player.Unlock()
+	if out != nil {
+		out.Release()
+	}
+	if done != nil {
+		<-done
+	}
+}
+
+// releasePrepared closes the song opened in advance and stops decoding it e.g. when it leaves the queue
+func (player *musicPlayer) releasePrepared() {
+	// Warning: never call this if the player is not locked
+	player.stopDecoding()
+	if player.state.prepared != nil {
+		player.state.prepared.in.Release()
+		player.state.prepared = nil
+	}
+}
+
+// resampleOptions returns the options of the sox rate effect that converts a song to the rate of the output
+// Returns nil if the rates are the same
+func resampleOptions(in *sox.SignalInfo, out *sox.SignalInfo) []interface{} {
+	if in.Rate() == out.Rate() || out.Rate() <= 0 {
+		return nil
+	}
+	// -h is the high quality resampling
+	return []interface{}{"-h", strconv.FormatFloat(out.Rate(), 'f', 0, 64)}
+}
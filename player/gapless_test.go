@@ -0,0 +1,110 @@
+package player
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/krig/go-sox"
+)
+
+func TestResampleOptions(t *testing.T) {
+	fmt.Println("TestResampleOptions")
+	cd := sox.NewSignalInfo(44100, 2, 16, 0, nil)
+	dvd := sox.NewSignalInfo(48000, 2, 16, 0, nil)
+	if resampleOptions(cd, sox.NewSignalInfo(44100, 2, 16, 0, nil)) != nil {
+		t.Errorf("Expected no resampling for the same rate")
+	}
+	expected := []interface{}{"-h", "48000"}
+	found := resampleOptions(cd, dvd)
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("Expected\n---\n%v\n---\nbut found\n---\n%v\n---\n", expected, found)
+	}
+}
+
+func TestKeepOutput(t *testing.T) {
+	fmt.Println("TestKeepOutput")
+	initTestPlayer(t)
+	first := &sox.Format{}
+	if !player.keepOutput(first) {
+		t.Fatalf("Expected the output to be kept")
+	}
+	if player.keepOutput(&sox.Format{}) {
+		t.Errorf("Expected only one output to be kept")
+	}
+	if player.state.output != first {
+		t.Errorf("Expected the first output to be kept")
+	}
+	// the output is not real, so it is not released
+	player.state.output = nil
+}
+
+func TestPrepareFollowing(t *testing.T) {
+	fmt.Println("TestPrepareFollowing")
+	initTestPlayer(t)
+	player.output = nullSink{}
+	player.state.queue = []string{"test_sounds/beep9.mp3", "test_sounds/beep28.mp3"}
+	player.prepareFollowing()
+	if player.state.prepared == nil {
+		t.Fatalf("Expected the following song to be opened")
+	}
+	checkStr(t, "test_sounds/beep28.mp3", player.state.prepared.path)
+	prepared := player.state.prepared.in
+	if !strings.HasSuffix(prepared.Filename(), ".wav") {
+		t.Errorf("Expected the following song to be decoded, found %s", prepared.Filename())
+	}
+
+	if player.openInput("test_sounds/beep28.mp3") != prepared {
+		t.Errorf("Expected the prepared song to be used")
+	}
+	if player.state.prepared != nil {
+		t.Errorf("Expected the prepared song to be taken")
+	}
+	prepared.Release()
+}
+
+func TestPlayKeepsOutput(t *testing.T) {
+	fmt.Println("TestPlayKeepsOutput")
+	initTestPlayer(t)
+	player.output = nullSink{}
+	defer player.releaseOutput()
+	player.state.queue = []string{"test_sounds/beep9.mp3", "test_sounds/beep28.mp3"}
+	err := player.playSingleFile("test_sounds/beep9.mp3", 0, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	kept := player.state.output
+	if kept == nil {
+		t.Fatalf("Expected the output to stay open")
+	}
+	err = player.playSingleFile("test_sounds/beep28.mp3", 0, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if player.state.output != kept {
+		t.Errorf("Expected the same output to be used for the following song")
+	}
+}
+
+func TestStopReleasesPrepared(t *testing.T) {
+	fmt.Println("TestStopReleasesPrepared")
+	initTestPlayer(t)
+	player.output = nullSink{}
+	player.state.queue = []string{"test_sounds/beep9.mp3", "test_sounds/beep28.mp3"}
+	player.prepareFollowing()
+	if player.state.prepared == nil {
+		t.Fatalf("Expected the following song to be opened")
+	}
+	player.clearQueue()
+	if player.state.prepared != nil {
+		t.Errorf("Expected the prepared song to be released with the queue")
+	}
+
+	player.state.queue = []string{"test_sounds/beep9.mp3", "test_sounds/beep28.mp3"}
+	player.prepareFollowing()
+	player.stop()
+	if player.state.prepared != nil {
+		t.Errorf("Expected the prepared song to be released on stop")
+	}
+}
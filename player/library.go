@@ -0,0 +1,375 @@
+package player
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/krig/go-sox"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Track is a song of the library with its tags and the file details used to find out if it changed
+type Track struct {
+	Path string
+	Tags
+	// Duration in seconds. 0 if not known
+	Duration float64
+	Size     int64
+	ModTime  time.Time
+}
+
+// LibraryStats describes the library and its last scan
+type LibraryStats struct {
+	Tracks   int
+	Artists  int
+	Albums   int
+	Genres   int
+	Duration float64
+	Size     int64
+	// a scan is running
+	Scanning bool
+	// when the last scan finished, how long it took and what it found
+	LastScan    *time.Time `json:"LastScan,omitempty"`
+	ScanSeconds float64
+	Added       int
+	Updated     int
+	Removed     int
+}
+
+// errLibraryClosed stops the scan of a closed library
+var errLibraryClosed = errors.New("library is closed")
+
+// libraryIndexVersion changes every time the tracks get new fields e.g. the album artist and the disc,
+// so that the tags of an older index are read again
+const libraryIndexVersion = 2
+
+// libraryIndex is the library saved in the index file
+type libraryIndex struct {
+	Version int
+	Scanned *time.Time `json:"Scanned,omitempty"`
+	Tracks  []Track
+}
+
+// library holds the songs found in the music roots and keeps them in an index file
+// so that a rescan reads only the files that changed. The tracks are found by path and by id
+// The library has its own lock that may be taken while the player is locked, never the other way round
+type library struct {
+	sync.Mutex
+	indexFile string
+	tracks    map[string]Track
+	ids       map[string]string
+	scanning  bool
+	lastScan  LibraryStats
+	// the index was written by an older version, so the next scan reads every file
+	outdated bool
+	// the scan that is running, it is stopped when the library is closed
+	running sync.WaitGroup
+	closed  bool
+}
+
+func newLibrary() *library {
+	return &library{tracks: make(map[string]Track), ids: make(map[string]string)}
+}
+
+// setTracks replaces the tracks of the library
+func (library *library) setTracks(tracks map[string]Track) {
+	// Warning: never call this if the library is not locked
+	library.tracks = tracks
+	library.ids = make(map[string]string, len(tracks))
+	for path := range tracks {
+		library.ids[trackId(path)] = path
+	}
+}
+
+// load reads the index saved in indexFile and saves the index there from now on
+// Returns error if there is an index file that cannot be read
+func (library *library) load(indexFile string) error {
+	library.Lock()
+	defer library.Unlock()
+	library.indexFile = indexFile
+
+	data, err := ioutil.ReadFile(indexFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	index := libraryIndex{}
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		return err
+	}
+	tracks := make(map[string]Track, len(index.Tracks))
+	for _, track := range index.Tracks {
+		tracks[track.Path] = track
+	}
+	library.setTracks(tracks)
+	library.lastScan.LastScan = index.Scanned
+	library.outdated = index.Version < libraryIndexVersion
+	return nil
+}
+
+// save writes the index to the index file if there is one
+// The file is replaced at once so that a crash never leaves half of it
+func (library *library) save() error {
+	// Warning: never call this if the library is not locked
+	if len(library.indexFile) == 0 {
+		return nil
+	}
+	index := libraryIndex{Version: libraryIndexVersion, Scanned: library.lastScan.LastScan, Tracks: library.sortedTracks()}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tmpFile := library.indexFile + ".tmp"
+	err = ioutil.WriteFile(tmpFile, data, 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, library.indexFile)
+}
+
+// sortedTracks returns the tracks sorted by path
+func (library *library) sortedTracks() []Track {
+	// Warning: never call this if the library is not locked
+	tracks := make([]Track, 0, len(library.tracks))
+	for _, track := range library.tracks {
+		tracks = append(tracks, track)
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].Path < tracks[j].Path
+	})
+	return tracks
+}
+
+// dirTracks returns the paths of the tracks in a directory and all directories in it sorted by path
+// Returns false if the library has not been scanned yet
+func (library *library) dirTracks(dir string) ([]string, bool) {
+	library.Lock()
+	defer library.Unlock()
+	if library.lastScan.LastScan == nil {
+		return nil, false
+	}
+	paths := make([]string, 0)
+	for path := range library.tracks {
+		if isInside(dir, path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, true
+}
+
+// startScan marks the library as being scanned
+// Returns the tracks known so far or error if a scan is already running
+func (library *library) startScan() (map[string]Track, error) {
+	library.Lock()
+	defer library.Unlock()
+	if library.scanning || library.closed {
+		return nil, errors.New(library_scanning_msg)
+	}
+	library.scanning = true
+	library.running.Add(1)
+	known := make(map[string]Track, len(library.tracks))
+	for path, track := range library.tracks {
+		known[path] = track
+	}
+	return known, nil
+}
+
+// scan walks the roots recursively and indexes the supported files
+// Files that did not change since the last scan keep their tags unless full is true or the index is outdated,
+// the others are read again and files that are gone are removed
+// The scan is stopped if the library is closed and the tracks stay as they were
+// Returns the stats and the paths of the added, changed and removed tracks
+func (library *library) scan(roots []string, known map[string]Track, full bool) (LibraryStats, []string) {
+	defer library.running.Done()
+	start := time.Now()
+	library.Lock()
+	full = full || library.outdated
+	library.Unlock()
+	tracks := make(map[string]Track)
+	changed := make([]string, 0)
+	added, updated := 0, 0
+	for _, root := range roots {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if library.isClosed() {
+				return errLibraryClosed
+			}
+			// unreadable directories are skipped, the rest of the root is still scanned
+			if err != nil || !info.Mode().IsRegular() || !isSupportedType(path) {
+				return nil
+			}
+			if _, ok := tracks[path]; ok {
+				// nested roots
+				return nil
+			}
+			track, ok := known[path]
+			if ok && !full && track.Size == info.Size() && track.ModTime.Equal(info.ModTime()) {
+				tracks[path] = track
+				return nil
+			}
+			if ok {
+				updated++
+			} else {
+				added++
+			}
+			changed = append(changed, path)
+			tracks[path] = readTrack(path, info)
+			return nil
+		})
+	}
+	if library.isClosed() {
+		library.Lock()
+		defer library.Unlock()
+		library.scanning = false
+		return library.stats(), nil
+	}
+	removed := 0
+	for path := range known {
+		if _, ok := tracks[path]; !ok {
+			removed++
+			changed = append(changed, path)
+		}
+	}
+
+	library.Lock()
+	defer library.Unlock()
+	library.setTracks(tracks)
+	library.scanning = false
+	library.outdated = false
+	finished := time.Now()
+	library.lastScan = LibraryStats{
+		LastScan:    &finished,
+		ScanSeconds: finished.Sub(start).Seconds(),
+		Added:       added,
+		Updated:     updated,
+		Removed:     removed,
+	}
+	err := library.save()
+	if err != nil {
+		fmt.Println("cannot save library index ", err.Error())
+	}
+	return library.stats(), changed
+}
+
+// isClosed checks if the library is closed and scans must stop
+func (library *library) isClosed() bool {
+	library.Lock()
+	defer library.Unlock()
+	return library.closed
+}
+
+// close stops the scan that is running and waits until it ends, so that SoX can be released
+// No scan is started after the library is closed
+func (library *library) close() {
+	library.Lock()
+	library.closed = true
+	library.Unlock()
+	library.running.Wait()
+}
+
+// readTrack reads the tags and the duration of a file
+func readTrack(path string, info os.FileInfo) Track {
+	tags, _ := readTags(path)
+	return Track{
+		Path:     path,
+		Tags:     tags,
+		Duration: fileDuration(path),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}
+}
+
+// fileDuration reads the duration of a song with SoX
+// Returns 0 if the file cannot be opened or its length is unknown
+func fileDuration(path string) float64 {
+	in := sox.OpenRead(path)
+	if in == nil {
+		return 0
+	}
+	defer in.Release()
+	return signalDuration(in.Signal()).Seconds()
+}
+
+// albumArtist returns the artist of the album a track is on - the album artist if it is known
+func albumArtist(track Track) string {
+	if len(track.AlbumArtist) > 0 {
+		return track.AlbumArtist
+	}
+	return track.Artist
+}
+
+// albumKey identifies the album of a track by its name and its artist, so that albums with the same name
+// by different artists are different albums e.g. two "Greatest Hits"
+// Returns empty string if the track has no album
+func albumKey(track Track) string {
+	if len(track.Album) == 0 {
+		return ""
+	}
+	return strings.ToLower(track.Album) + "\x00" + strings.ToLower(albumArtist(track))
+}
+
+// stats counts the tracks, artists, albums and genres of the library
+func (library *library) stats() LibraryStats {
+	// Warning: never call this if the library is not locked
+	stats := library.lastScan
+	stats.Scanning = library.scanning
+	artists := make(map[string]bool)
+	albums := make(map[string]bool)
+	genres := make(map[string]bool)
+	stats.Tracks, stats.Duration, stats.Size = 0, 0, 0
+	for _, track := range library.tracks {
+		stats.Tracks++
+		stats.Duration += track.Duration
+		stats.Size += track.Size
+		if len(track.Artist) > 0 {
+			artists[strings.ToLower(track.Artist)] = true
+		}
+		if key := albumKey(track); len(key) > 0 {
+			albums[key] = true
+		}
+		if len(track.Genre) > 0 {
+			genres[strings.ToLower(track.Genre)] = true
+		}
+	}
+	stats.Artists, stats.Albums, stats.Genres = len(artists), len(albums), len(genres)
+	return stats
+}
+
+// rescanLibrary scans the music roots in the background. Only the changed files are read
+// unless full is true
+// Returns the library stats or error if there are no music roots or a scan is already running
+func (player *musicPlayer) rescanLibrary(full bool) (LibraryStats, error) {
+	player.Lock()
+	roots := append([]string{}, player.musicRoots...)
+	player.Unlock()
+	if len(roots) == 0 {
+		return LibraryStats{}, errors.New(no_music_roots_msg)
+	}
+	known, err := player.library.startScan()
+	if err != nil {
+		return player.getLibraryStats(), err
+	}
+	go func() {
+		stats, changed := player.library.scan(roots, known, full)
+		player.publish(Event{Type: eventLibrary, Info: stats})
+		player.syncQueue(changed)
+	}()
+	return player.getLibraryStats(), nil
+}
+
+// getLibraryStats gets the number of tracks, artists, albums and genres in the library
+// and the results of the last scan
+func (player *musicPlayer) getLibraryStats() LibraryStats {
+	player.library.Lock()
+	defer player.library.Unlock()
+	return player.library.stats()
+}
@@ -0,0 +1,245 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// initLibraryDir creates a music root with a tagged song in a nested directory and an untagged one
+// Returns the real path of the root
+func initLibraryDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "music_player_library")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dir, err = realPath(dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = os.MkdirAll(filepath.Join(dir, "Tester", "Beeps"), 0777)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	writeTestFile(t, dir, "Tester/Beeps/01.mp3", id3v2Tag(3,
+		id3v2Frame(3, "TIT2", 0, []byte("Beep")),
+		id3v2Frame(3, "TPE1", 0, []byte("Tester")),
+		id3v2Frame(3, "TALB", 0, []byte("Beeps")),
+		id3v2Frame(3, "TCON", 0, []byte("Noise"))))
+	writeTestFile(t, dir, "untagged.mp3", make([]byte, 64))
+	writeTestFile(t, dir, "notes.txt", []byte("not a song"))
+	return dir
+}
+
+// waitForScan waits until the library scan started by rescanLibrary finishes
+func waitForScan(t *testing.T) LibraryStats {
+	for i := 0; i < 200; i++ {
+		stats := player.getLibraryStats()
+		if !stats.Scanning {
+			return stats
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Library scan did not finish")
+	return LibraryStats{}
+}
+
+func TestLibraryScan(t *testing.T) {
+	fmt.Println("TestLibraryScan")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	library := newLibrary()
+
+	known, err := library.startScan()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = library.startScan()
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+	stats, _ := library.scan([]string{dir}, known, false)
+	checkInt(t, 2, stats.Tracks)
+	checkInt(t, 1, stats.Artists)
+	checkInt(t, 1, stats.Albums)
+	checkInt(t, 1, stats.Genres)
+	checkInt(t, 2, stats.Added)
+	tagged, err := os.Stat(filepath.Join(dir, "Tester/Beeps/01.mp3"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkInt(t, int(tagged.Size())+64, int(stats.Size))
+	if stats.Scanning || stats.LastScan == nil {
+		t.Errorf("Expected a finished scan, found %v", stats)
+	}
+	track := library.tracks[filepath.Join(dir, "Tester/Beeps/01.mp3")]
+	checkStr(t, "Beep", track.Title)
+	checkStr(t, "Noise", track.Genre)
+}
+
+func TestLibraryIncrementalScan(t *testing.T) {
+	fmt.Println("TestLibraryIncrementalScan")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	indexFile := filepath.Join(dir, "library.json")
+	library := newLibrary()
+	err := library.load(indexFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	known, _ := library.startScan()
+	library.scan([]string{dir}, known, false)
+
+	// a new library reads the index and only the changes are found
+	library = newLibrary()
+	err = library.load(indexFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkInt(t, 2, len(library.tracks))
+	writeTestFile(t, dir, "Tester/Beeps/02.mp3", make([]byte, 32))
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "untagged.mp3"), later, later)
+	os.Remove(filepath.Join(dir, "Tester/Beeps/01.mp3"))
+
+	known, _ = library.startScan()
+	stats, _ := library.scan([]string{dir}, known, false)
+	checkInt(t, 2, stats.Tracks)
+	checkInt(t, 1, stats.Added)
+	checkInt(t, 1, stats.Updated)
+	checkInt(t, 1, stats.Removed)
+	checkInt(t, 0, stats.Artists)
+
+	// nothing changed
+	known, _ = library.startScan()
+	stats, _ = library.scan([]string{dir}, known, false)
+	checkInt(t, 0, stats.Added+stats.Updated+stats.Removed)
+
+	// a full scan reads everything again
+	known, _ = library.startScan()
+	stats, _ = library.scan([]string{dir}, known, true)
+	checkInt(t, 2, stats.Updated)
+}
+
+func TestLibraryOutdatedIndex(t *testing.T) {
+	fmt.Println("TestLibraryOutdatedIndex")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	indexFile := filepath.Join(dir, "library.json")
+	library := newLibrary()
+	library.load(indexFile)
+	known, _ := library.startScan()
+	library.scan([]string{dir}, known, false)
+
+	// an index without a version has the tags of an older version
+	data, err := ioutil.ReadFile(indexFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	index := libraryIndex{}
+	json.Unmarshal(data, &index)
+	checkInt(t, libraryIndexVersion, index.Version)
+	index.Version = 0
+	data, _ = json.Marshal(index)
+	ioutil.WriteFile(indexFile, data, 0666)
+
+	library = newLibrary()
+	err = library.load(indexFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	known, _ = library.startScan()
+	stats, _ := library.scan([]string{dir}, known, false)
+	checkInt(t, 2, stats.Updated)
+
+	// the index is up to date again
+	known, _ = library.startScan()
+	stats, _ = library.scan([]string{dir}, known, false)
+	checkInt(t, 0, stats.Updated)
+}
+
+func TestLibraryClose(t *testing.T) {
+	fmt.Println("TestLibraryClose")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	library := newLibrary()
+	known, _ := library.startScan()
+	closed := make(chan struct{})
+	go func() {
+		library.close()
+		close(closed)
+	}()
+	for i := 0; i < 200 && !library.isClosed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the scan stops at once and close waits for it
+	stats, changed := library.scan([]string{dir}, known, false)
+	checkInt(t, 0, stats.Tracks)
+	checkInt(t, 0, len(changed))
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected close to return after the scan")
+	}
+	_, err := library.startScan()
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestRescanLibrary(t *testing.T) {
+	fmt.Println("TestRescanLibrary")
+	initTestPlayer(t)
+	_, err := player.rescanLibrary(false)
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, no_music_roots_msg, err.Error())
+
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	initTestPlayer(t, dir)
+	events := player.subscribe()
+	defer player.unsubscribe(events)
+	_, err = player.rescanLibrary(false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	stats := waitForScan(t)
+	checkInt(t, 2, stats.Tracks)
+	event := checkEvent(t, events, eventLibrary)
+	checkInt(t, 2, event.Info.(LibraryStats).Tracks)
+}
+
+func TestAddDirFromLibrary(t *testing.T) {
+	fmt.Println("TestAddDirFromLibrary")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	initTestPlayer(t, dir)
+	// the library has no playlists, they are read from the disk
+	writeTestFile(t, dir, "list.m3u", []byte("untagged.mp3\n"))
+	expected := []string{filepath.Join(dir, "Tester/Beeps/01.mp3"), filepath.Join(dir, "untagged.mp3"),
+		filepath.Join(dir, "untagged.mp3")}
+
+	// the disk is read before the first scan
+	items, err := player.addPlayItem(dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkNames(t, expected, items)
+
+	known, _ := player.library.startScan()
+	player.library.scan([]string{dir}, known, false)
+	// a file the library does not know yet is not added
+	writeTestFile(t, dir, "Tester/Beeps/02.mp3", make([]byte, 64))
+	items, err = player.addPlayItem(dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkNames(t, expected, items)
+}
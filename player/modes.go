@@ -0,0 +1,205 @@
+package player
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// player's repeat modes
+const (
+	repeatOff = iota
+	repeatOne
+	repeatAll
+)
+
+// repeatNames are the names of the repeat modes used by the web service
+var repeatNames = map[int]string{
+	repeatOff: "off",
+	repeatOne: "one",
+	repeatAll: "all",
+}
+
+// ModeInfo describes the repeat and shuffle modes and the crossfade of the player
+type ModeInfo struct {
+	// off, one or all
+	Repeat string
+	// true if the queue is played in shuffled order
+	Shuffle bool
+	// seconds the songs overlap. Only when crossfade is on and the output can play two songs at once
+	Crossfade float64 `json:"Crossfade,omitempty"`
+}
+
+// QueueInfo describes the queue of the player
+type QueueInfo struct {
+	ModeInfo
+	// Index of the current song in the queue
+	Current int
+	// Indexes of the songs in the order they are played. Only when shuffled
+	Order []int `json:"Order,omitempty"`
+	// Tags of the songs in the queue. Only when at least one song has tags
+	Tags []Tags `json:"Tags,omitempty"`
+}
+
+// modeInfo returns the info about the modes
+func (player *musicPlayer) modeInfo() ModeInfo {
+	// Warning: never call this if the player is not locked
+	return ModeInfo{Repeat: repeatNames[player.state.repeat], Shuffle: player.state.shuffle,
+		Crossfade: player.crossfadeLength()}
+}
+
+// getModes gets the repeat and shuffle modes of the player
+func (player *musicPlayer) getModes() ModeInfo {
+	player.Lock()
+	defer player.Unlock()
+	return player.modeInfo()
+}
+
+// setRepeat sets the repeat mode - off, one or all
+// Returns the modes or error if the mode is unknown
+func (player *musicPlayer) setRepeat(mode string) (ModeInfo, error) {
+	player.Lock()
+	defer player.Unlock()
+	for repeat, name := range repeatNames {
+		if name == mode {
+			player.state.repeat = repeat
+			player.stateChanged()
+			return player.modeInfo(), nil
+		}
+	}
+	return player.modeInfo(), errors.New(invalid_repeat_mode_msg)
+}
+
+// setShuffle turns shuffle on or off
+// Turning shuffle on creates a new order with the current song first, so previous has nothing to go back to
+// Returns the modes or error if the mode is unknown
+func (player *musicPlayer) setShuffle(mode string) (ModeInfo, error) {
+	player.Lock()
+	defer player.Unlock()
+	switch mode {
+	case "on":
+		if !player.state.shuffle {
+			player.state.shuffle = true
+			player.shuffleOrder(true)
+		}
+	case "off":
+		player.state.shuffle = false
+		player.state.order = nil
+	default:
+		return player.modeInfo(), errors.New(invalid_shuffle_mode_msg)
+	}
+	player.stateChanged()
+	return player.modeInfo(), nil
+}
+
+// random returns the source of randomness for shuffling
+func (player *musicPlayer) random() *rand.Rand {
+	// Warning: never call this if the player is not locked
+	if player.rand == nil {
+		player.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return player.rand
+}
+
+// shuffleOrder creates a new random order of the queue
+// The current song stays first if keepCurrent is true
+func (player *musicPlayer) shuffleOrder(keepCurrent bool) {
+	// Warning: never call this if the player is not locked
+	player.state.order = player.random().Perm(len(player.state.queue))
+	if !keepCurrent {
+		return
+	}
+	for i, index := range player.state.order {
+		if index == player.state.current {
+			player.state.order[0], player.state.order[i] = player.state.order[i], player.state.order[0]
+			break
+		}
+	}
+}
+
+// addToOrder puts a song that was appended to the queue at a random place after the current song
+func (player *musicPlayer) addToOrder(index int) {
+	// Warning: never call this if the player is not locked
+	if !player.state.shuffle {
+		return
+	}
+	first := player.orderPosition(player.state.current) + 1
+	if first > len(player.state.order) {
+		first = len(player.state.order)
+	}
+	position := first + player.random().Intn(len(player.state.order)-first+1)
+	player.state.order = append(player.state.order, 0)
+	copy(player.state.order[position+1:], player.state.order[position:])
+	player.state.order[position] = index
+}
+
+// playOrder returns the indexes of the songs in the order they are played
+func (player *musicPlayer) playOrder() []int {
+	// Warning: never call this if the player is not locked
+	if player.state.shuffle && len(player.state.order) == len(player.state.queue) {
+		return player.state.order
+	}
+	order := make([]int, len(player.state.queue))
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// orderPosition returns the position of a song in the play order or -1 if it is not there
+func (player *musicPlayer) orderPosition(index int) int {
+	// Warning: never call this if the player is not locked
+	for position, el := range player.playOrder() {
+		if el == index {
+			return position
+		}
+	}
+	return -1
+}
+
+// firstIndex returns the index of the song the queue starts with
+func (player *musicPlayer) firstIndex() int {
+	// Warning: never call this if the player is not locked
+	order := player.playOrder()
+	if len(order) == 0 {
+		return 0
+	}
+	return order[0]
+}
+
+// followingIndex returns the index of the song to be played after the current one
+// Repeat one is ignored when skip is true i.e. the user asked for the next song
+// Returns false if the queue is finished
+func (player *musicPlayer) followingIndex(skip bool) (int, bool) {
+	// Warning: never call this if the player is not locked
+	if len(player.state.queue) == 0 {
+		return 0, false
+	}
+	if !skip && player.state.repeat == repeatOne && player.state.current < len(player.state.queue) {
+		return player.state.current, true
+	}
+	order := player.playOrder()
+	position := player.orderPosition(player.state.current)
+	if position >= 0 && position+1 < len(order) {
+		return order[position+1], true
+	}
+	if player.state.repeat == repeatAll {
+		return order[0], true
+	}
+	return 0, false
+}
+
+// precedingIndex returns the index of the song played before the current one
+// Returns false if the current song is the first one
+func (player *musicPlayer) precedingIndex() (int, bool) {
+	// Warning: never call this if the player is not locked
+	order := player.playOrder()
+	position := player.orderPosition(player.state.current)
+	if position > 0 {
+		return order[position-1], true
+	}
+	if position == 0 && player.state.repeat == repeatAll {
+		return order[len(order)-1], true
+	}
+	return 0, false
+}
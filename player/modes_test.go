@@ -0,0 +1,95 @@
+package player
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func initModesPlayer(t *testing.T) {
+	initTestPlayer(t)
+	player.rand = rand.New(rand.NewSource(1))
+	player.state.queue = []string{"a.mp3", "b.mp3", "c.mp3", "d.mp3"}
+}
+
+func checkIndex(t *testing.T, expected int, expectedOk bool, found int, foundOk bool) {
+	if foundOk != expectedOk || (expectedOk && found != expected) {
+		t.Errorf("Expected\n---\n%d %t\n---\nbut found\n---\n%d %t\n---\n", expected, expectedOk, found, foundOk)
+	}
+}
+
+func TestFollowingIndexRepeatOff(t *testing.T) {
+	fmt.Println("TestFollowingIndexRepeatOff")
+	initModesPlayer(t)
+	player.state.current = 1
+	index, ok := player.followingIndex(false)
+	checkIndex(t, 2, true, index, ok)
+	player.state.current = 3
+	index, ok = player.followingIndex(false)
+	checkIndex(t, 0, false, index, ok)
+	index, ok = player.precedingIndex()
+	checkIndex(t, 2, true, index, ok)
+	player.state.current = 0
+	index, ok = player.precedingIndex()
+	checkIndex(t, 0, false, index, ok)
+}
+
+func TestFollowingIndexRepeatOne(t *testing.T) {
+	fmt.Println("TestFollowingIndexRepeatOne")
+	initModesPlayer(t)
+	player.setRepeat("one")
+	player.state.current = 3
+	index, ok := player.followingIndex(false)
+	checkIndex(t, 3, true, index, ok)
+	index, ok = player.followingIndex(true)
+	checkIndex(t, 0, false, index, ok)
+}
+
+func TestFollowingIndexRepeatAll(t *testing.T) {
+	fmt.Println("TestFollowingIndexRepeatAll")
+	initModesPlayer(t)
+	player.setRepeat("all")
+	player.state.current = 3
+	index, ok := player.followingIndex(false)
+	checkIndex(t, 0, true, index, ok)
+	player.state.current = 0
+	index, ok = player.precedingIndex()
+	checkIndex(t, 3, true, index, ok)
+}
+
+func TestShuffle(t *testing.T) {
+	fmt.Println("TestShuffle")
+	initModesPlayer(t)
+	player.state.current = 2
+	player.setShuffle("on")
+	order := append([]int{}, player.state.order...)
+	checkIntFatal(t, 4, len(order))
+	checkInt(t, 2, order[0])
+
+	// walking the order forward and back visits the same songs
+	visited := []int{player.state.current}
+	for index, ok := player.followingIndex(false); ok; index, ok = player.followingIndex(false) {
+		player.state.current = index
+		visited = append(visited, index)
+	}
+	if !reflect.DeepEqual(order, visited) {
+		t.Errorf("Expected\n---\n%v\n---\nbut found\n---\n%v\n---\n", order, visited)
+	}
+	index, ok := player.precedingIndex()
+	checkIndex(t, order[2], true, index, ok)
+
+	player.state.queue = append(player.state.queue, "e.mp3")
+	player.addToOrder(4)
+	sorted := append([]int{}, player.state.order...)
+	sort.Ints(sorted)
+	if !reflect.DeepEqual([]int{0, 1, 2, 3, 4}, sorted) {
+		t.Errorf("Expected all songs in the order, but found %v", player.state.order)
+	}
+
+	player.setShuffle("off")
+	player.state.current = 1
+	index, ok = player.followingIndex(false)
+	checkIndex(t, 2, true, index, ok)
+}
@@ -0,0 +1,755 @@
+package player
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mpdVersion is the version of the MPD protocol reported to the clients
+const mpdVersion = "0.19.0"
+
+// Error codes of the MPD protocol
+const (
+	mpdErrorArg        = 2
+	mpdErrorPassword   = 3
+	mpdErrorPermission = 4
+	mpdErrorUnknown    = 5
+	mpdErrorNoExist    = 50
+	mpdErrorSystem     = 52
+)
+
+// mpdError is an error sent to an MPD client as "ACK [code@index] {command} message"
+type mpdError struct {
+	code    int
+	message string
+}
+
+func (err *mpdError) Error() string {
+	return err.message
+}
+
+// mpdSubsystems maps the events of the player to the MPD subsystems reported by idle
+var mpdSubsystems = map[string]string{
+	eventPlaying: "player",
+	eventPaused:  "player",
+	eventStopped: "player",
+	eventError:   "player",
+	eventQueue:   "playlist",
+	eventVolume:  "mixer",
+	eventMode:    "options",
+}
+
+// mpdCommand is an MPD command mapped onto the player
+// run returns the lines of the response (each ending with a new line)
+type mpdCommand struct {
+	role int
+	run  func(client *mpdClient, args []string) (string, error)
+}
+
+// mpdCommands are the MPD commands the player understands. idle, noidle, close and the command lists
+// are handled by the connection itself
+var mpdCommands map[string]mpdCommand
+
+func init() {
+	mpdCommands = map[string]mpdCommand{
+		"ping":          {rolePublic, func(client *mpdClient, args []string) (string, error) { return "", nil }},
+		"password":      {rolePublic, mpdPassword},
+		"commands":      {rolePublic, mpdListCommands},
+		"status":        {roleReadOnly, mpdStatus},
+		"currentsong":   {roleReadOnly, mpdCurrentSong},
+		"playlistinfo":  {roleReadOnly, mpdPlaylistInfo},
+		"listplaylists": {roleReadOnly, mpdListPlaylists},
+		"play":          {roleController, mpdPlay},
+		"playid":        {roleController, mpdPlay},
+		"pause":         {roleController, mpdPause},
+		"stop":          {roleController, mpdStop},
+		"next":          {roleController, mpdNext},
+		"previous":      {roleController, mpdPrevious},
+		"add":           {roleController, mpdAdd},
+		"load":          {roleController, mpdLoad},
+		"clear":         {roleController, mpdClear},
+		"setvol":        {roleController, mpdSetVolume},
+		"repeat":        {roleController, mpdRepeat},
+		"single":        {roleController, mpdSingle},
+		"random":        {roleController, mpdRandom},
+		"crossfade":     {roleController, mpdCrossfade},
+		"save":          {roleAdmin, mpdSave},
+	}
+}
+
+// mpdServer serves the MPD protocol on a TCP listener so that MPD clients can control the player
+type mpdServer struct {
+	sync.Mutex
+	listener net.Listener
+	clients  map[net.Conn]bool
+	closed   bool
+	// playlist version reported by status. Changes every time the queue changes
+	version int
+	events  chan Event
+}
+
+// startMPD starts listening for MPD clients on address
+// Returns error if the address cannot be listened on
+func startMPD(address string) (*mpdServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	server := &mpdServer{
+		listener: listener,
+		clients:  make(map[net.Conn]bool),
+		version:  1,
+		events:   player.subscribe(),
+	}
+	go server.countVersions()
+	go server.serve()
+	return server, nil
+}
+
+// countVersions increases the playlist version on every change of the queue
+func (server *mpdServer) countVersions() {
+	for event := range server.events {
+		if event.Type == eventQueue {
+			server.Lock()
+			server.version += 1
+			server.Unlock()
+		}
+	}
+}
+
+// playlistVersion returns the current playlist version
+func (server *mpdServer) playlistVersion() int {
+	server.Lock()
+	defer server.Unlock()
+	return server.version
+}
+
+// serve accepts MPD clients until the server is closed
+func (server *mpdServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.Lock()
+		if server.closed {
+			server.Unlock()
+			conn.Close()
+			return
+		}
+		server.clients[conn] = true
+		server.Unlock()
+		go server.handle(conn)
+	}
+}
+
+// close stops accepting MPD clients and disconnects the connected ones
+func (server *mpdServer) close() {
+	server.Lock()
+	defer server.Unlock()
+	if server.closed {
+		return
+	}
+	server.closed = true
+	server.listener.Close()
+	for conn := range server.clients {
+		conn.Close()
+	}
+	player.unsubscribe(server.events)
+}
+
+// mpdClient is a connected MPD client
+type mpdClient struct {
+	server *mpdServer
+	writer *bufio.Writer
+	// role given by the password. Everything is allowed if the service has no tokens
+	role int
+	// events not reported by idle yet
+	events chan Event
+}
+
+// handle talks to an MPD client until it closes the connection
+func (server *mpdServer) handle(conn net.Conn) {
+	client := &mpdClient{
+		server: server,
+		writer: bufio.NewWriter(conn),
+		role:   rolePublic,
+		events: player.subscribe(),
+	}
+	if len(player.tokens) == 0 {
+		client.role = roleAdmin
+	}
+	lines := make(chan string)
+	defer func() {
+		player.unsubscribe(client.events)
+		conn.Close()
+		// let the reader see the closed connection
+		for range lines {
+		}
+		server.Lock()
+		delete(server.clients, conn)
+		server.Unlock()
+	}()
+
+	// lines are read in the background so that idle can wait for noidle and events at the same time
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	client.write("OK MPD " + mpdVersion + "\n")
+	for line := range lines {
+		command, args, err := parseMPDCommand(line)
+		switch {
+		case err != nil:
+			client.writeError(0, "", err)
+		case command == "close":
+			return
+		case command == "idle":
+			if !client.idle(args, lines) {
+				return
+			}
+		case command == "noidle":
+			// not idle - nothing to cancel
+			client.write("OK\n")
+		case command == "command_list_begin" || command == "command_list_ok_begin":
+			if !client.commandList(command == "command_list_ok_begin", lines) {
+				return
+			}
+		default:
+			response, err := client.execute(command, args)
+			if err != nil {
+				client.writeError(0, command, err)
+			} else {
+				client.write(response + "OK\n")
+			}
+		}
+	}
+}
+
+// write sends a response to the client
+func (client *mpdClient) write(response string) {
+	client.writer.WriteString(response)
+	client.writer.Flush()
+}
+
+// writeError sends "ACK [code@index] {command} message" to the client
+func (client *mpdClient) writeError(index int, command string, err error) {
+	code := mpdErrorNoExist
+	if mpdErr, ok := err.(*mpdError); ok {
+		code = mpdErr.code
+	}
+	client.write(fmt.Sprintf("ACK [%d@%d] {%s} %s\n", code, index, command, err.Error()))
+}
+
+// execute runs a single command if the role of the client allows it
+// Returns the response lines or error
+func (client *mpdClient) execute(command string, args []string) (string, error) {
+	mpdCmd, ok := mpdCommands[command]
+	if !ok {
+		return "", &mpdError{mpdErrorUnknown, "unknown command \"" + command + "\""}
+	}
+	if client.role < mpdCmd.role {
+		return "", &mpdError{mpdErrorPermission, "you don't have permission for \"" + command + "\""}
+	}
+	return mpdCmd.run(client, args)
+}
+
+// commandList runs the commands up to command_list_end and sends their responses at once
+// With command_list_ok_begin every response ends with list_OK
+// Stops at the first error. Returns false if the connection is closed
+func (client *mpdClient) commandList(listOk bool, lines chan string) bool {
+	commands := make([]string, 0)
+	for line := range lines {
+		if line == "command_list_end" {
+			response := ""
+			for i, commandLine := range commands {
+				command, args, err := parseMPDCommand(commandLine)
+				if err == nil {
+					var output string
+					output, err = client.execute(command, args)
+					response += output
+				}
+				if err != nil {
+					client.write(response)
+					client.writeError(i, command, err)
+					return true
+				}
+				if listOk {
+					response += "list_OK\n"
+				}
+			}
+			client.write(response + "OK\n")
+			return true
+		}
+		commands = append(commands, line)
+	}
+	return false
+}
+
+// idle waits until one of the subsystems changes or noidle is received
+// Changes made since the last idle are reported at once. Returns false if the connection is closed
+func (client *mpdClient) idle(subsystems []string, lines chan string) bool {
+	wanted := func(subsystem string) bool {
+		return len(subsystems) == 0 || contains(subsystems, subsystem)
+	}
+	changed := make([]string, 0)
+	addChange := func(event Event) {
+		subsystem, ok := mpdSubsystems[event.Type]
+		if ok && wanted(subsystem) && !contains(changed, subsystem) {
+			changed = append(changed, subsystem)
+		}
+	}
+	// changes that happened before idle
+	for pending := true; pending; {
+		select {
+		case event := <-client.events:
+			addChange(event)
+		default:
+			pending = false
+		}
+	}
+
+	for len(changed) == 0 {
+		select {
+		case event, ok := <-client.events:
+			if !ok {
+				return false
+			}
+			addChange(event)
+		case line, ok := <-lines:
+			if !ok || line != "noidle" {
+				// only noidle is allowed while idle
+				return false
+			}
+			client.write("OK\n")
+			return true
+		}
+	}
+
+	response := ""
+	for _, subsystem := range changed {
+		response += "changed: " + subsystem + "\n"
+	}
+	client.write(response + "OK\n")
+	return true
+}
+
+// parseMPDCommand splits a command line into the command and its arguments
+// Arguments can be in double quotes with \" and \\ escaped
+// Returns error if a quote is not closed
+func parseMPDCommand(line string) (string, []string, error) {
+	args := make([]string, 0)
+	current := ""
+	inQuotes, hasArg := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(line):
+			i++
+			current += string(line[i])
+		case c == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case !inQuotes && (c == ' ' || c == '\t'):
+			if hasArg {
+				args = append(args, current)
+			}
+			current, hasArg = "", false
+		default:
+			current += string(c)
+			hasArg = true
+		}
+	}
+	if inQuotes {
+		return "", nil, &mpdError{mpdErrorArg, "Invalid unquoted character"}
+	}
+	if hasArg {
+		args = append(args, current)
+	}
+	if len(args) == 0 {
+		return "", nil, &mpdError{mpdErrorUnknown, "No command given"}
+	}
+	return args[0], args[1:], nil
+}
+
+// mpdBool converts a boolean to MPD's 0 or 1
+func mpdBool(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// mpdArgument returns the argument with index i or error if there are not enough arguments
+func mpdArgument(args []string, i int) (string, error) {
+	if i >= len(args) {
+		return "", &mpdError{mpdErrorArg, "too few arguments"}
+	}
+	return args[i], nil
+}
+
+// mpdFile returns the name of a song for MPD clients - relative to the music root it is in
+func (player *musicPlayer) mpdFile(path string) string {
+	// Warning: never call this if the player is not locked
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	for _, root := range player.musicRoots {
+		if isInside(root, absPath) {
+			if rel, err := filepath.Rel(root, absPath); err == nil {
+				return rel
+			}
+		}
+	}
+	return path
+}
+
+// mpdSong describes a song of the queue the way MPD does
+func (player *musicPlayer) mpdSong(index int) string {
+	// Warning: never call this if the player is not locked
+	song := player.state.queue[index]
+	name := filepath.Base(song)
+	response := fmt.Sprintf("file: %s\nTitle: %s\n", player.mpdFile(song), strings.TrimSuffix(name, filepath.Ext(name)))
+	if index == player.state.current && player.state.duration > 0 {
+		duration := player.state.duration.Seconds()
+		response += fmt.Sprintf("Time: %d\nduration: %.3f\n", int(duration), duration)
+	}
+	// the position in the queue is used as id as songs have no ids of their own
+	return response + fmt.Sprintf("Pos: %d\nId: %d\n", index, index)
+}
+
+func mpdPassword(client *mpdClient, args []string) (string, error) {
+	token, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	role, ok := player.tokens[token]
+	if !ok {
+		return "", &mpdError{mpdErrorPassword, "incorrect password"}
+	}
+	client.role = role
+	return "", nil
+}
+
+func mpdListCommands(client *mpdClient, args []string) (string, error) {
+	response := ""
+	for _, command := range []string{"close", "idle", "noidle", "command_list_begin", "command_list_ok_begin"} {
+		response += "command: " + command + "\n"
+	}
+	for command, mpdCmd := range mpdCommands {
+		if client.role >= mpdCmd.role {
+			response += "command: " + command + "\n"
+		}
+	}
+	return response, nil
+}
+
+func mpdStatus(client *mpdClient, args []string) (string, error) {
+	player.Lock()
+	defer player.Unlock()
+	volume := 0
+	if !player.state.muted {
+		volume = int(player.state.volume + 0.5)
+	}
+	state := "stop"
+	switch player.state.status {
+	case playing:
+		state = "play"
+	case paused:
+		state = "pause"
+	}
+	response := fmt.Sprintf("volume: %d\nrepeat: %d\nrandom: %d\nsingle: %d\nconsume: 0\n"+
+		"playlist: %d\nplaylistlength: %d\nstate: %s\n",
+		volume, mpdBool(player.state.repeat != repeatOff), mpdBool(player.state.shuffle),
+		mpdBool(player.state.repeat == repeatOne), client.server.playlistVersion(), len(player.state.queue), state)
+	if crossfade := player.crossfadeLength(); crossfade > 0 {
+		response += fmt.Sprintf("xfade: %d\n", int(crossfade+0.5))
+	}
+
+	if player.state.current < len(player.state.queue) {
+		response += fmt.Sprintf("song: %d\nsongid: %d\n", player.state.current, player.state.current)
+		if state != "stop" {
+			elapsed := player.elapsed().Seconds()
+			duration := player.state.duration.Seconds()
+			response += fmt.Sprintf("time: %d:%d\nelapsed: %.3f\n", int(elapsed), int(duration), elapsed)
+			if duration > 0 {
+				response += fmt.Sprintf("duration: %.3f\n", duration)
+			}
+			if player.state.sampleRate > 0 {
+				response += fmt.Sprintf("audio: %.0f:*:%d\n", player.state.sampleRate, player.state.channels)
+			}
+		}
+		if next, ok := player.followingIndex(false); ok {
+			response += fmt.Sprintf("nextsong: %d\nnextsongid: %d\n", next, next)
+		}
+	}
+	return response, nil
+}
+
+func mpdCurrentSong(client *mpdClient, args []string) (string, error) {
+	player.Lock()
+	defer player.Unlock()
+	if player.state.current >= len(player.state.queue) {
+		return "", nil
+	}
+	return player.mpdSong(player.state.current), nil
+}
+
+func mpdPlaylistInfo(client *mpdClient, args []string) (string, error) {
+	player.Lock()
+	defer player.Unlock()
+	first, last := 0, len(player.state.queue)
+	if len(args) > 0 {
+		// a single position or a range start:end
+		parts := strings.SplitN(args[0], ":", 2)
+		var err error
+		first, err = strconv.Atoi(parts[0])
+		if err != nil || first < 0 || first >= len(player.state.queue) {
+			return "", &mpdError{mpdErrorArg, "Bad song index"}
+		}
+		last = first + 1
+		if len(parts) == 2 {
+			last, err = strconv.Atoi(parts[1])
+			if err != nil || last < first {
+				return "", &mpdError{mpdErrorArg, "Bad song index"}
+			}
+			if last > len(player.state.queue) {
+				last = len(player.state.queue)
+			}
+		}
+	}
+	response := ""
+	for i := first; i < last; i++ {
+		response += player.mpdSong(i)
+	}
+	return response, nil
+}
+
+func mpdListPlaylists(client *mpdClient, args []string) (string, error) {
+	playlists, err := player.listPlaylists()
+	if err != nil {
+		// no playlists is not an error for MPD
+		return "", nil
+	}
+	response := ""
+	listed := make(map[string]bool)
+	for _, playlist := range playlists {
+		// a.m3u and a.pls are both named a, load plays the first type of playlistExtensions
+		name := strings.TrimSuffix(playlist, filepath.Ext(playlist))
+		if !listed[name] {
+			listed[name] = true
+			response += "playlist: " + name + "\n"
+		}
+	}
+	return response, nil
+}
+
+func mpdPlay(client *mpdClient, args []string) (string, error) {
+	if len(args) > 0 {
+		_, err := player.jump(args[0])
+		return "", err
+	}
+	player.Lock()
+	status, current, length := player.state.status, player.state.current, len(player.state.queue)
+	player.Unlock()
+	switch {
+	case status == playing:
+		return "", nil
+	case status == paused:
+		_, err := player.resume()
+		return "", err
+	case current < length:
+		_, err := player.jump(strconv.Itoa(current))
+		return "", err
+	}
+	return "", nil
+}
+
+func mpdPause(client *mpdClient, args []string) (string, error) {
+	player.Lock()
+	isPlaying := player.state.status == playing
+	player.Unlock()
+	pause := isPlaying
+	if len(args) > 0 {
+		pause = args[0] == "1"
+	}
+	var err error
+	if pause && isPlaying {
+		_, err = player.pause()
+	} else if !pause && !isPlaying {
+		_, err = player.resume()
+	}
+	return "", err
+}
+
+func mpdStop(client *mpdClient, args []string) (string, error) {
+	player.stopKeepingQueue()
+	return "", nil
+}
+
+func mpdNext(client *mpdClient, args []string) (string, error) {
+	_, err := player.next()
+	return "", err
+}
+
+func mpdPrevious(client *mpdClient, args []string) (string, error) {
+	_, err := player.previous()
+	return "", err
+}
+
+func mpdAdd(client *mpdClient, args []string) (string, error) {
+	name, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	_, err = player.appendToQueue(name)
+	return "", err
+}
+
+// mpdLoad appends a saved playlist to the queue
+// The name is the one listplaylists shows - without the extension
+func mpdLoad(client *mpdClient, args []string) (string, error) {
+	name, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	path, err := mpdPlaylistPath(name)
+	if err != nil {
+		return "", err
+	}
+	player.Lock()
+	entries := player.regularFileEntries(path)
+	if len(entries) == 0 {
+		player.Unlock()
+		return "", errors.New(format_not_supported_msg)
+	}
+	player.addEntries(entries)
+	player.stateChanged()
+	player.Unlock()
+	player.readQueueTags()
+	return "", nil
+}
+
+// mpdPlaylistPath finds the saved playlist with the given name trying each of the playlist extensions
+// Returns error if there is no such playlist
+func mpdPlaylistPath(name string) (string, error) {
+	candidates := make([]string, 0, len(playlistExtensions)+1)
+	if len(playlistType(name)) > 0 {
+		candidates = append(candidates, name)
+	}
+	for _, extension := range playlistExtensions {
+		candidates = append(candidates, name+extension)
+	}
+	for _, candidate := range candidates {
+		if path, err := player.savedPlaylist(candidate); err == nil {
+			return path, nil
+		}
+	}
+	return "", &mpdError{mpdErrorNoExist, "No such playlist"}
+}
+
+func mpdClear(client *mpdClient, args []string) (string, error) {
+	player.stopKeepingQueue()
+	player.clearQueue()
+	return "", nil
+}
+
+func mpdSetVolume(client *mpdClient, args []string) (string, error) {
+	level, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	_, err = player.setVolume(level)
+	if err != nil {
+		return "", &mpdError{mpdErrorArg, err.Error()}
+	}
+	return "", nil
+}
+
+// mpdSetRepeat maps MPD's repeat and single onto the repeat mode of the player
+func mpdSetRepeat(args []string, mode func(repeat int, on bool) string) (string, error) {
+	value, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	if value != "0" && value != "1" {
+		return "", &mpdError{mpdErrorArg, "Boolean (0/1) expected"}
+	}
+	player.Lock()
+	repeat := player.state.repeat
+	player.Unlock()
+	_, err = player.setRepeat(mode(repeat, value == "1"))
+	return "", err
+}
+
+func mpdRepeat(client *mpdClient, args []string) (string, error) {
+	return mpdSetRepeat(args, func(repeat int, on bool) string {
+		switch {
+		case !on:
+			return repeatNames[repeatOff]
+		case repeat == repeatOne:
+			return repeatNames[repeatOne]
+		}
+		return repeatNames[repeatAll]
+	})
+}
+
+func mpdSingle(client *mpdClient, args []string) (string, error) {
+	return mpdSetRepeat(args, func(repeat int, on bool) string {
+		switch {
+		case on:
+			return repeatNames[repeatOne]
+		case repeat == repeatOne:
+			return repeatNames[repeatAll]
+		}
+		return repeatNames[repeat]
+	})
+}
+
+func mpdRandom(client *mpdClient, args []string) (string, error) {
+	value, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	mode := map[string]string{"0": "off", "1": "on"}[value]
+	if len(mode) == 0 {
+		return "", &mpdError{mpdErrorArg, "Boolean (0/1) expected"}
+	}
+	_, err = player.setShuffle(mode)
+	return "", err
+}
+
+func mpdCrossfade(client *mpdClient, args []string) (string, error) {
+	seconds, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	if _, err := strconv.ParseUint(seconds, 10, 32); err != nil {
+		return "", &mpdError{mpdErrorArg, "Integer expected: " + seconds}
+	}
+	_, err = player.setCrossfade(seconds)
+	return "", err
+}
+
+func mpdSave(client *mpdClient, args []string) (string, error) {
+	name, err := mpdArgument(args, 0)
+	if err != nil {
+		return "", err
+	}
+	_, err = player.saveAsPlaylist(name)
+	if err != nil {
+		return "", &mpdError{mpdErrorSystem, err.Error()}
+	}
+	return "", nil
+}
@@ -0,0 +1,171 @@
+package player
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMPDCommand(t *testing.T) {
+	fmt.Println("TestParseMPDCommand")
+	command, args, err := parseMPDCommand(`add "test_sounds/beep 9.mp3"`)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "add", command)
+	if !reflect.DeepEqual([]string{"test_sounds/beep 9.mp3"}, args) {
+		t.Errorf("Unexpected arguments %v", args)
+	}
+
+	command, args, err = parseMPDCommand(`save  "say \"hi\""  ""`)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "save", command)
+	if !reflect.DeepEqual([]string{`say "hi"`, ""}, args) {
+		t.Errorf("Unexpected arguments %v", args)
+	}
+
+	_, _, err = parseMPDCommand(`add "unclosed`)
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+	_, _, err = parseMPDCommand("   ")
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+// mpdTestClient sends MPD commands and reads the responses up to OK or ACK
+type mpdTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (client *mpdTestClient) call(t *testing.T, command string) string {
+	client.conn.SetDeadline(time.Now().Add(2 * time.Second))
+	fmt.Fprintf(client.conn, "%s\n", command)
+	response := ""
+	for {
+		line, err := client.reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s: %s", command, err.Error())
+		}
+		response += line
+		if line == "OK\n" || strings.HasPrefix(line, "ACK ") {
+			return response
+		}
+	}
+}
+
+func startTestMPD(t *testing.T, tokens map[string]string) (*mpdServer, *mpdTestClient) {
+	initTestPlayer(t)
+	player.setTokens(tokens)
+	server, err := startMPD("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	client := &mpdTestClient{conn: conn, reader: bufio.NewReader(conn)}
+	greeting, _ := client.reader.ReadString('\n')
+	checkStr(t, "OK MPD "+mpdVersion+"\n", greeting)
+	return server, client
+}
+
+func TestMPDStatus(t *testing.T) {
+	fmt.Println("TestMPDStatus")
+	server, client := startTestMPD(t, nil)
+	defer server.close()
+
+	checkStr(t, "OK\n", client.call(t, "add test_sounds/beep9.mp3"))
+	checkStr(t, "OK\n", client.call(t, "repeat 1"))
+	checkStr(t, "OK\n", client.call(t, "setvol 50"))
+	checkStr(t, "OK\n", client.call(t, "crossfade 3"))
+	checkStr(t, "ACK [2@0] {crossfade} Integer expected: 2.5\n", client.call(t, "crossfade 2.5"))
+	found := client.call(t, "status")
+	for _, line := range []string{"volume: 50\n", "repeat: 1\n", "single: 0\n", "playlistlength: 1\n",
+		"state: stop\n", "song: 0\n", "xfade: 3\n"} {
+		if !strings.Contains(found, line) {
+			t.Errorf("Expected %q in\n%s", line, found)
+		}
+	}
+	checkStr(t, "file: test_sounds/beep9.mp3\nTitle: beep9\nPos: 0\nId: 0\nOK\n", client.call(t, "playlistinfo"))
+	checkStr(t, "ACK [5@0] {dance} unknown command \"dance\"\n", client.call(t, "dance"))
+}
+
+func TestMPDCommandList(t *testing.T) {
+	fmt.Println("TestMPDCommandList")
+	server, client := startTestMPD(t, nil)
+	defer server.close()
+
+	fmt.Fprint(client.conn, "command_list_ok_begin\nrandom 1\nsingle 1\n")
+	checkStr(t, "list_OK\nlist_OK\nOK\n", client.call(t, "command_list_end"))
+	modes := player.getModes()
+	checkStr(t, "one", modes.Repeat)
+	if !modes.Shuffle {
+		t.Errorf("Expected shuffle to be on")
+	}
+
+	fmt.Fprint(client.conn, "command_list_begin\nrandom 0\nrandom 2\n")
+	checkStr(t, "ACK [2@1] {random} Boolean (0/1) expected\n", client.call(t, "command_list_end"))
+}
+
+func TestMPDIdle(t *testing.T) {
+	fmt.Println("TestMPDIdle")
+	server, client := startTestMPD(t, nil)
+	defer server.close()
+
+	// changes made before idle are reported at once
+	player.setVolume("40")
+	checkStr(t, "changed: mixer\nOK\n", client.call(t, "idle"))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		player.setRepeat("all")
+	}()
+	checkStr(t, "changed: options\nOK\n", client.call(t, "idle options player"))
+
+	fmt.Fprint(client.conn, "idle\n")
+	checkStr(t, "OK\n", client.call(t, "noidle"))
+}
+
+func TestMPDPassword(t *testing.T) {
+	fmt.Println("TestMPDPassword")
+	server, client := startTestMPD(t, map[string]string{"ro": "readonly", "ctl": "controller"})
+	defer server.close()
+
+	checkStr(t, "ACK [4@0] {status} you don't have permission for \"status\"\n", client.call(t, "status"))
+	checkStr(t, "ACK [3@0] {password} incorrect password\n", client.call(t, "password nope"))
+	checkStr(t, "OK\n", client.call(t, "password ro"))
+	checkStr(t, "OK\n", client.call(t, "currentsong"))
+	checkStr(t, "ACK [4@0] {random} you don't have permission for \"random\"\n", client.call(t, "random 1"))
+	checkStr(t, "OK\n", client.call(t, "password ctl"))
+	checkStr(t, "OK\n", client.call(t, "random 1"))
+	checkStr(t, "ACK [4@0] {save} you don't have permission for \"save\"\n", client.call(t, "save abc"))
+}
+
+func TestMPDLoadSavedPlaylist(t *testing.T) {
+	fmt.Println("TestMPDLoadSavedPlaylist")
+	server, client := startTestMPD(t, nil)
+	defer server.close()
+	defer os.Remove(getTestPlaylistDir() + "mpd round trip.m3u")
+
+	checkStr(t, "OK\n", client.call(t, "add test_sounds/beep9.mp3"))
+	checkStr(t, "OK\n", client.call(t, `save "mpd round trip"`))
+	found := client.call(t, "listplaylists")
+	if !strings.Contains(found, "playlist: mpd round trip\n") {
+		t.Errorf("Expected the saved playlist in\n%s", found)
+	}
+	checkStr(t, "OK\n", client.call(t, "clear"))
+	checkStr(t, "OK\n", client.call(t, `load "mpd round trip"`))
+	checkStr(t, "file: test_sounds/beep9.mp3\nTitle: beep9\nPos: 0\nId: 0\nOK\n", client.call(t, "playlistinfo"))
+	checkStr(t, "ACK [50@0] {load} No such playlist\n", client.call(t, "load test_sounds/beep9"))
+}
@@ -0,0 +1,145 @@
+package player
+
+import (
+	"errors"
+	"github.com/krig/go-sox"
+	"strings"
+)
+
+// OutputSink opens the destination the player writes samples to
+type OutputSink interface {
+	// Open opens the output for a song with the given signal characteristics
+	// Returns nil if the output could not be opened
+	Open(signal *sox.SignalInfo) *sox.Format
+	// String describes the sink the way it is specified at startup
+	String() string
+}
+
+// autoOutputDevices are the device types tried by the automatic sink.
+// Using "alsa" or "pulseaudio" should work for most files on Linux.
+// "coreaudio" for OSX, "waveaudio" for Windows
+var autoOutputDevices = []string{"alsa", "pulseaudio", "coreaudio", "waveaudio"}
+
+// fileOutputTypes are the file types a file sink can write
+var fileOutputTypes = []string{"wav", "flac"}
+
+// autoSink tries the known sound devices one after the other
+type autoSink struct{}
+
+func (sink autoSink) Open(signal *sox.SignalInfo) *sox.Format {
+	for _, deviceType := range autoOutputDevices {
+		out := sox.OpenWrite("default", signal, nil, deviceType)
+		if out != nil {
+			return out
+		}
+	}
+	return nil
+}
+
+func (sink autoSink) String() string {
+	return "auto"
+}
+
+// deviceSink writes to a single sound device e.g. alsa "hw:1,0" or a pulseaudio sink
+type deviceSink struct {
+	deviceType string
+	device     string
+}
+
+func (sink deviceSink) Open(signal *sox.SignalInfo) *sox.Format {
+	return sox.OpenWrite(sink.device, signal, nil, sink.deviceType)
+}
+
+func (sink deviceSink) String() string {
+	return sink.deviceType + ":" + sink.device
+}
+
+// fileSink writes the samples to a wav or flac file instead of a sound device
+// The file is rewritten every time the output is opened, so it keeps only the songs played since then -
+// the songs played one after the other while the output stays open
+type fileSink struct {
+	fileType string
+	path     string
+}
+
+func (sink fileSink) Open(signal *sox.SignalInfo) *sox.Format {
+	return sox.OpenWrite(sink.path, signal, nil, sink.fileType)
+}
+
+func (sink fileSink) String() string {
+	return sink.fileType + ":" + sink.path
+}
+
+// sharedOutput checks if a sink can play two songs at once, so that the songs can overlap
+// A file is written by one song at a time and alsa hw devices are opened exclusively
+func sharedOutput(sink OutputSink) bool {
+	switch sink := sink.(type) {
+	case fileSink:
+		return false
+	case deviceSink:
+		return sink.deviceType != "alsa" ||
+			!(strings.HasPrefix(sink.device, "hw") || strings.HasPrefix(sink.device, "plughw"))
+	}
+	return true
+}
+
+// nullSink discards all samples. Songs are decoded as fast as possible, not in real time
+type nullSink struct{}
+
+func (sink nullSink) Open(signal *sox.SignalInfo) *sox.Format {
+	return sox.OpenWrite("-n", signal, nil, "null")
+}
+
+func (sink nullSink) String() string {
+	return "null"
+}
+
+// NewOutputSink creates an output sink from its specification
+// Supported specifications are:
+//
+//	auto - try alsa, pulseaudio, coreaudio and waveaudio with their default devices
+//	alsa[:device], pulseaudio[:device], coreaudio[:device], waveaudio[:device] - a specific sound device
+//	wav:path, flac:path - write to a file
+//	null - discard the output
+//
+// Returns error if the specification is not recognised
+func NewOutputSink(spec string) (OutputSink, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	switch {
+	case kind == "" || kind == "auto":
+		if len(arg) > 0 {
+			break
+		}
+		return autoSink{}, nil
+	case kind == "null":
+		if len(arg) > 0 {
+			break
+		}
+		return nullSink{}, nil
+	case contains(autoOutputDevices, kind):
+		if len(arg) == 0 {
+			arg = "default"
+		}
+		return deviceSink{deviceType: kind, device: arg}, nil
+	case contains(fileOutputTypes, kind):
+		if len(arg) == 0 {
+			break
+		}
+		return fileSink{fileType: kind, path: arg}, nil
+	}
+	return nil, errors.New(unknown_output_msg)
+}
+
+// contains checks if a list of strings contains the given one
+func contains(list []string, s string) bool {
+	for _, el := range list {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
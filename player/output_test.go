@@ -0,0 +1,41 @@
+package player
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewOutputSink(t *testing.T) {
+	fmt.Println("TestNewOutputSink")
+	specs := map[string]string{
+		"":                  "auto",
+		"auto":              "auto",
+		"null":              "null",
+		"alsa":              "alsa:default",
+		"alsa:hw:1,0":       "alsa:hw:1,0",
+		"pulseaudio:studio": "pulseaudio:studio",
+		"coreaudio":         "coreaudio:default",
+		"wav:/tmp/out.wav":  "wav:/tmp/out.wav",
+		"flac:out.flac":     "flac:out.flac",
+	}
+	for spec, expected := range specs {
+		sink, err := NewOutputSink(spec)
+		if err != nil {
+			t.Errorf("Unexpected error for %s - %s", spec, err.Error())
+			continue
+		}
+		checkStr(t, expected, sink.String())
+	}
+}
+
+func TestNewOutputSinkInvalid(t *testing.T) {
+	fmt.Println("TestNewOutputSinkInvalid")
+	for _, spec := range []string{"speaker", "wav", "flac:", "null:abc", "auto:abc"} {
+		_, err := NewOutputSink(spec)
+		if err == nil {
+			t.Errorf("Expected error for %s", spec)
+			continue
+		}
+		checkStr(t, unknown_output_msg, err.Error())
+	}
+}
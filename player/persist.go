@@ -0,0 +1,215 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// savedState is the part of the player's state that survives restarts of the service
+type savedState struct {
+	Queue     []string
+	Current   int
+	Position  float64
+	Volume    float64
+	Muted     bool
+	Repeat    int
+	Shuffle   bool
+	Order     []int   `json:"Order,omitempty"`
+	Crossfade float64 `json:"Crossfade,omitempty"`
+	// titles and durations of the songs in the queue that were read from playlists
+	Playlist []playlistEntry `json:"Playlist,omitempty"`
+}
+
+// stateChanged is called every time the state of the player changes
+// Publishes the changes and writes the state to the state file if there is one
+func (player *musicPlayer) stateChanged() {
+	// Warning: never call this if the player is not locked
+	player.forgetPlaylistInfo()
+	player.forgetTags()
+	player.publishChanges()
+	if len(player.stateFile) == 0 {
+		return
+	}
+	err := player.writeState()
+	if err != nil {
+		fmt.Println("cannot save player state ", err.Error())
+	}
+}
+
+// snapshot copies the state that is saved
+func (player *musicPlayer) snapshot() savedState {
+	// Warning: never call this if the player is not locked
+	saved := savedState{
+		Queue:     append([]string{}, player.state.queue...),
+		Current:   player.state.current,
+		Position:  player.elapsed().Seconds(),
+		Volume:    player.state.volume,
+		Muted:     player.state.muted,
+		Repeat:    player.state.repeat,
+		Shuffle:   player.state.shuffle,
+		Crossfade: player.state.crossfade,
+	}
+	if player.state.shuffle {
+		saved.Order = append([]int{}, player.playOrder()...)
+	}
+	saved.Playlist = player.queuePlaylistInfo()
+	return saved
+}
+
+// queuePlaylistInfo returns the titles and durations read from playlists in the order of the queue
+func (player *musicPlayer) queuePlaylistInfo() []playlistEntry {
+	// Warning: never call this if the player is not locked
+	var entries []playlistEntry
+	seen := make(map[string]bool)
+	for _, song := range player.state.queue {
+		if entry, ok := player.playlistInfo[song]; ok && !seen[song] {
+			seen[song] = true
+			entry.Path = song
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// forgetPlaylistInfo forgets the titles and durations of the songs that left the queue,
+// so that a song added again by its path does not keep an old title
+func (player *musicPlayer) forgetPlaylistInfo() {
+	// Warning: never call this if the player is not locked
+	if len(player.playlistInfo) == 0 {
+		return
+	}
+	queued := make(map[string]bool, len(player.state.queue))
+	for _, song := range player.state.queue {
+		queued[song] = true
+	}
+	for song := range player.playlistInfo {
+		if !queued[song] {
+			delete(player.playlistInfo, song)
+		}
+	}
+}
+
+// writeState writes the state to the state file
+// The file is replaced at once so that a crash never leaves half of it
+func (player *musicPlayer) writeState() error {
+	// Warning: never call this if the player is not locked
+	data, err := json.MarshalIndent(player.snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile := player.stateFile + ".tmp"
+	err = ioutil.WriteFile(tmpFile, data, 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, player.stateFile)
+}
+
+// saveState writes the state to the state file
+// Returns error if the state could not be written
+func (player *musicPlayer) saveState() error {
+	player.Lock()
+	defer player.Unlock()
+	if len(player.stateFile) == 0 {
+		return nil
+	}
+	return player.writeState()
+}
+
+// restoreState reads the state saved in stateFile and restores it paused
+// Songs that no longer exist or are outside the music roots are dropped from the queue
+// The state is saved to stateFile from now on
+// Returns error if there is a state file that cannot be read
+func (player *musicPlayer) restoreState(stateFile string) error {
+	player.Lock()
+	defer player.Unlock()
+	// the restored state is not published as a change
+	defer func() {
+		player.published = player.snapshot()
+	}()
+	player.stateFile = stateFile
+
+	data, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved := savedState{}
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return err
+	}
+
+	if saved.Volume >= 0 && saved.Volume <= maxVolume {
+		player.state.volume = saved.Volume
+	}
+	player.state.muted = saved.Muted
+	if _, ok := repeatNames[saved.Repeat]; ok {
+		player.state.repeat = saved.Repeat
+	}
+	player.state.shuffle = saved.Shuffle
+	if saved.Crossfade >= 0 && saved.Crossfade <= maxCrossfade {
+		player.state.crossfade = saved.Crossfade
+	}
+
+	// keep the songs that still exist
+	player.state.queue = make([]string, 0, len(saved.Queue))
+	newIndex := make(map[int]int)
+	for i, song := range saved.Queue {
+		if _, err := os.Stat(song); err == nil && player.isInMusicRoots(song) {
+			newIndex[i] = len(player.state.queue)
+			player.state.queue = append(player.state.queue, song)
+		}
+	}
+	if len(player.state.queue) == 0 {
+		player.state.current = 0
+		player.state.status = waiting
+		return nil
+	}
+	for _, entry := range saved.Playlist {
+		if player.playlistInfo != nil && contains(player.state.queue, entry.Path) {
+			player.playlistInfo[entry.Path] = entry
+		}
+	}
+
+	current, ok := newIndex[saved.Current]
+	position := saved.Position
+	if !ok {
+		// the current song is gone - the next one that exists starts from the beginning
+		current, position = 0, 0
+		for i := saved.Current + 1; i < len(saved.Queue); i++ {
+			if index, ok := newIndex[i]; ok {
+				current = index
+				break
+			}
+		}
+	}
+	player.state.current = current
+
+	if player.state.shuffle {
+		player.state.order = make([]int, 0, len(player.state.queue))
+		seen := make(map[int]bool)
+		for _, i := range saved.Order {
+			if index, ok := newIndex[i]; ok && !seen[index] {
+				seen[index] = true
+				player.state.order = append(player.state.order, index)
+			}
+		}
+		if len(player.state.order) != len(player.state.queue) {
+			player.shuffleOrder(true)
+		}
+	}
+
+	// restored songs wait paused to be resumed
+	player.state.status = paused
+	if position < 0 {
+		position = 0
+	}
+	player.state.durationPaused = time.Duration(position * float64(time.Second))
+	return nil
+}
@@ -0,0 +1,96 @@
+package player
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testStateFile = "test_state.json"
+
+func TestSaveRestoreState(t *testing.T) {
+	fmt.Println("TestSaveRestoreState")
+	defer os.Remove(testStateFile)
+	initTestPlayer(t)
+	player.stateFile = testStateFile
+	player.state.queue = []string{"test_sounds/beep28.mp3", "test_sounds/beep36.mp3", "test_sounds/beep9.mp3"}
+	player.state.current = 1
+	player.state.status = paused
+	player.state.durationPaused = 1500 * time.Millisecond
+	player.state.volume = 40
+	player.state.repeat = repeatAll
+	player.state.crossfade = 3
+	player.playlistInfo["test_sounds/beep36.mp3"] = playlistEntry{Duration: 1, Title: "Tester - Beep"}
+	err := player.saveState()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	initTestPlayer(t)
+	err = player.restoreState(testStateFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []string{"test_sounds/beep28.mp3", "test_sounds/beep36.mp3", "test_sounds/beep9.mp3"}
+	if !reflect.DeepEqual(expected, player.state.queue) {
+		t.Errorf("Expected\n---\n%v\n---\nbut found\n---\n%v\n---\n", expected, player.state.queue)
+	}
+	checkInt(t, 1, player.state.current)
+	checkInt(t, paused, player.state.status)
+	checkInt(t, repeatAll, player.state.repeat)
+	checkDuration(t, 1.5, 1.5, player.state.durationPaused.Seconds())
+	checkDuration(t, 40, 40, player.state.volume)
+	checkDuration(t, 3, 3, player.state.crossfade)
+	expectedInfo := playlistEntry{Path: "test_sounds/beep36.mp3", Duration: 1, Title: "Tester - Beep"}
+	if !reflect.DeepEqual(expectedInfo, player.playlistInfo["test_sounds/beep36.mp3"]) {
+		t.Errorf("Expected\n---\n%v\n---\nbut found\n---\n%v\n---\n", expectedInfo,
+			player.playlistInfo["test_sounds/beep36.mp3"])
+	}
+}
+
+func TestForgetPlaylistInfo(t *testing.T) {
+	fmt.Println("TestForgetPlaylistInfo")
+	initTestPlayer(t)
+	player.Lock()
+	defer player.Unlock()
+	player.addEntries([]playlistEntry{{Path: "test_sounds/beep9.mp3", Duration: 1, Title: "Nine"},
+		{Path: "test_sounds/beep28.mp3", Duration: 1, Title: "Twenty-eight"}})
+	player.state.queue = player.state.queue[1:]
+	player.stateChanged()
+	if _, ok := player.playlistInfo["test_sounds/beep9.mp3"]; ok {
+		t.Errorf("Expected the title of the removed song to be forgotten")
+	}
+	checkStr(t, "Twenty-eight", player.playlistInfo["test_sounds/beep28.mp3"].Title)
+}
+
+func TestRestoreStateMissingSong(t *testing.T) {
+	fmt.Println("TestRestoreStateMissingSong")
+	defer os.Remove(testStateFile)
+	initTestPlayer(t)
+	player.stateFile = testStateFile
+	player.state.queue = []string{"test_sounds/beep28.mp3", "test_sounds/gone.mp3", "test_sounds/beep9.mp3"}
+	player.state.current = 1
+	player.state.status = paused
+	player.state.durationPaused = 2 * time.Second
+	player.saveState()
+
+	initTestPlayer(t)
+	player.restoreState(testStateFile)
+	checkInt(t, 2, len(player.state.queue))
+	checkStr(t, "test_sounds/beep9.mp3", player.state.queue[player.state.current])
+	checkDuration(t, 0, 0, player.state.durationPaused.Seconds())
+}
+
+func TestRestoreStateNoFile(t *testing.T) {
+	fmt.Println("TestRestoreStateNoFile")
+	initTestPlayer(t)
+	err := player.restoreState("no_such_state.json")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkInt(t, 0, len(player.state.queue))
+	checkInt(t, waiting, player.state.status)
+	checkStr(t, "no_such_state.json", player.stateFile)
+}
@@ -3,19 +3,25 @@ package player
 
 import "github.com/krig/go-sox"
 import (
-	"bufio"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-// supported playlist type
+// the playlist type the queue is saved as if the name has no playlist extension
 const playlistsExtension = ".m3u"
 
+// playlistExtensions are the supported playlist types
+var playlistExtensions = []string{".m3u", ".m3u8", ".pls", ".xspf"}
+
 // supportedExtensions are the file types music_player works with
 var supportedExtensions []string = []string{
 	"mp3",
@@ -99,23 +105,58 @@ var supportedExtensions []string = []string{
 	"xa",
 }
 
-// musicPlayer struct represents the player. Holds player's state, playlist's directory and mutexes for synchronisation
+// musicPlayer struct represents the player. Holds player's state, playlist's directory, output sink,
+// source of randomness for shuffling, the file the state is saved to, the directories music can be played from,
+// the API tokens with their roles, the bus the changes of the state are published to, the tags of the songs,
+// the titles and durations of the songs read from playlists, the library of the music roots
+// and mutexes for synchronisation
 type musicPlayer struct {
 	sync.Mutex
 	state          *state
 	playQueueMutex *sync.Mutex
+	playlistsMutex sync.Mutex
 	playlistsDir   string
+	output         OutputSink
+	rand           *rand.Rand
+	stateFile      string
+	musicRoots     []string
+	tokens         map[string]int
+	events         *eventBus
+	tags           map[string]Tags
+	playlistInfo   map[string]playlistEntry
+	library        *library
+	// the state the last events were published for
+	published savedState
 }
 
-// State struct holds the state of the player i.e. chain of effects, playing status, playing start time of a song,
-// player's song queue, current song
+// State struct holds the state of the player i.e. chain of effects, the chain of the song that fades out,
+// the output kept open between songs, the following song opened in advance and the chain decoding it, playing status,
+// playing start time of a song, player's song queue, current song, the song that was deleted while it plays,
+// the signal of the current song, the volume, repeat and shuffle modes, the crossfade and the shuffled order of the queue
 type state struct {
 	chain          *sox.EffectsChain
+	fading         *sox.EffectsChain
+	fadingDone     chan struct{}
+	crossfade      float64
+	output         *sox.Format
+	outputKept     int
+	prepared       *preparedSong
+	decoding       *sox.EffectsChain
+	decodingDone   chan struct{}
 	status         int
 	startTime      time.Time
 	durationPaused time.Duration
 	queue          []string
 	current        int
+	gone           string
+	duration       time.Duration
+	sampleRate     float64
+	channels       uint
+	volume         float64
+	muted          bool
+	repeat         int
+	shuffle        bool
+	order          []int
 }
 
 // player's possible statuses
@@ -125,6 +166,13 @@ const (
 	waiting
 )
 
+// statusNames are the names of the statuses used by the web service
+var statusNames = map[int]string{
+	playing: "playing",
+	paused:  "paused",
+	waiting: "waiting",
+}
+
 // init initialises player's state
 func (player *musicPlayer) init(playlistDir string) error {
 	player.Lock()
@@ -133,21 +181,38 @@ func (player *musicPlayer) init(playlistDir string) error {
 	player.state.status = waiting
 	player.state.current = 0
 	player.state.queue = make([]string, 0)
+	player.state.volume = maxVolume
 	player.playlistsDir = playlistDir
+	player.events = newEventBus()
+	player.tags = make(map[string]Tags)
+	player.playlistInfo = make(map[string]playlistEntry)
+	player.library = newLibrary()
+	player.published = player.snapshot()
 	return nil
 }
 
-// waitEnd is used to wait the end of playing queue
+// outputSink returns the sink songs are played to. Sound devices are tried automatically if none is set
+func (player *musicPlayer) outputSink() OutputSink {
+	if player.output == nil {
+		return autoSink{}
+	}
+	return player.output
+}
+
+// waitEnd is used to wait the end of playing queue and of the song that fades out
 func (player *musicPlayer) waitEnd() {
 	player.playQueueMutex.Lock()
 	defer player.playQueueMutex.Unlock()
+	player.waitFading()
 }
 
 // playSingleFile plays single file
+// With crossfade the song returns while its end is still fading out, so that the following song fades in over it
+// The output of the previous song is used if it is still open and the song is resampled to its rate
 // Returns error if file could not be played
 func (player *musicPlayer) playSingleFile(filename string, trim float64, ch chan error) error {
-	// Open the input file (with default parameters)
-	in := sox.OpenRead(filename)
+	// Open the input file (with default parameters) unless it was opened while the previous song played
+	in := player.openInput(filename)
 	if in == nil {
 		err := errors.New(no_sox_in_msg)
 		if ch != nil {
@@ -155,42 +220,38 @@ func (player *musicPlayer) playSingleFile(filename string, trim float64, ch chan
 		}
 		return err
 	}
-	defer in.Release()
 
-	// Open the output device: Specify the output signal characteristics.
+	// Open the output: Specify the output signal characteristics.
 	// Since we are using only simple effects, they are the same as the
-	// input file characteristics.
-	// Using "alsa" or "pulseaudio" should work for most files on Linux.
-	// "coreaudio" for OSX
-	// On other systems, other devices have to be used.
-	out := sox.OpenWrite("default", in.Signal(), nil, "alsa")
+	// input file characteristics. A kept output may have another rate.
+	out := player.openOutput(in.Signal())
+	if out == nil && player.endFading() {
+		// the device may not be shared with the song that fades out
+		out = player.openOutput(in.Signal())
+	}
 	if out == nil {
-		out = sox.OpenWrite("default", in.Signal(), nil, "pulseaudio")
-		if out == nil {
-			out = sox.OpenWrite("default", in.Signal(), nil, "coreaudio")
-			if out == nil {
-				out = sox.OpenWrite("default", in.Signal(), nil, "waveaudio")
-				if out == nil {
-					err := errors.New(no_sox_out_msg)
-					if ch != nil {
-						ch <- err
-					}
-					return err
-				}
-			}
+		in.Release()
+		err := errors.New(no_sox_out_msg)
+		if ch != nil {
+			ch <- err
 		}
+		return err
 	}
-	// It's observed that sox crashes at this step sometimes
-	defer out.Release()
 
 	if ch != nil {
 		ch <- nil
 	}
 
+	player.Lock()
+	gain := player.gain()
+	crossfade := player.crossfadeLength()
+	fadeIn := player.state.fading != nil
+	player.Unlock()
+	length := signalDuration(in.Signal()).Seconds() - trim
+
 	// Create an effects chain: Some effects need to know about the
 	// input or output encoding so we provide that information here.
 	chain := sox.CreateEffectsChain(in.Encoding(), out.Encoding())
-	defer chain.Release()
 
 	// The first effect in the effect chain must be something that can
 	// source samples; in this case, we use the built-in handler that
@@ -210,28 +271,100 @@ func (player *musicPlayer) playSingleFile(filename string, trim float64, ch chan
 		e.Release()
 	}
 
+	if gain != 1 {
+		interm_signal := in.Signal().Copy()
+
+		e = sox.CreateEffect(sox.FindEffect("vol"))
+		e.Options(strconv.FormatFloat(gain, 'f', 4, 64))
+		chain.Add(e, interm_signal, in.Signal())
+		e.Release()
+	}
+
+	fade := fadeOptions(length, crossfade, fadeIn)
+	if fade != nil {
+		interm_signal := in.Signal().Copy()
+
+		e = sox.CreateEffect(sox.FindEffect("fade"))
+		e.Options(fade...)
+		chain.Add(e, interm_signal, in.Signal())
+		e.Release()
+	}
+
 	// The last effect in the effect chain must be something that only consumes
 	// samples; in this case, we use the built-in handler that outputs data.
-	e = sox.CreateEffect(sox.FindEffect("output"))
-	e.Options(out)
-	chain.Add(e, in.Signal(), in.Signal())
-	e.Release()
+	if resample := resampleOptions(in.Signal(), out.Signal()); resample != nil {
+		interm_signal := in.Signal().Copy()
+
+		e = sox.CreateEffect(sox.FindEffect("rate"))
+		e.Options(resample...)
+		chain.Add(e, interm_signal, out.Signal())
+		e.Release()
+
+		e = sox.CreateEffect(sox.FindEffect("output"))
+		e.Options(out)
+		chain.Add(e, interm_signal, out.Signal())
+		e.Release()
+	} else {
+		e = sox.CreateEffect(sox.FindEffect("output"))
+		e.Options(out)
+		chain.Add(e, in.Signal(), in.Signal())
+		e.Release()
+	}
 
 	player.Lock()
 	player.state.chain = chain
 	player.state.status = playing
+	player.state.duration = signalDuration(in.Signal())
+	player.state.sampleRate = in.Signal().Rate()
+	player.state.channels = in.Signal().Channels()
 	player.state.startTime = time.Now()
 	if trim > 0 {
 		var milis int64 = int64(-trim * 1000)
 		player.state.startTime = player.state.startTime.Add(time.Duration(milis) * time.Millisecond)
 	}
+	player.publishSong(eventPlaying)
+	player.stateChanged()
 	player.Unlock()
+	go player.prepareFollowing()
 
 	// Flow samples through the effects processing chain until EOF is reached.
 	// Flow process is not locked as it must be possible to delete chain effects
 	// while Flow is being executed
 	// note: sox crashes at this step sometimes(rarely)
-	chain.Flow()
+	done := make(chan struct{})
+	go func() {
+		chain.Flow()
+		player.Lock()
+		if player.state.fading == chain {
+			player.state.fading = nil
+		}
+		if player.state.fadingDone == done {
+			player.state.fadingDone = nil
+		}
+		// the output stays open for the following song
+		kept := player.keepOutput(out)
+		player.Unlock()
+		chain.Release()
+		if !kept {
+			// It's observed that sox crashes at this step sometimes
+			out.Release()
+		}
+		in.Release()
+		close(done)
+	}()
+
+	if fadesOut(fade) {
+		select {
+		case <-done:
+		case <-time.After(time.Duration((length - crossfade) * float64(time.Second))):
+			if player.startFading(chain, done) {
+				return nil
+			}
+			<-done
+		}
+	} else {
+		<-done
+	}
 
 	player.Lock()
 	if player.state.status == playing {
@@ -242,6 +375,25 @@ func (player *musicPlayer) playSingleFile(filename string, trim float64, ch chan
 	return nil
 }
 
+// signalDuration calculates the duration of a song from its signal
+// Returns 0 if the length of the song is unknown
+func signalDuration(signal *sox.SignalInfo) time.Duration {
+	if signal.Rate() <= 0 || signal.Channels() == 0 {
+		return 0
+	}
+	// length is the number of samples in all channels
+	seconds := float64(signal.Length()) / float64(signal.Channels()) / signal.Rate()
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// resetSignal forgets the signal of the current song
+func (player *musicPlayer) resetSignal() {
+	// Warning: never call this if the player is not locked
+	player.state.duration = 0
+	player.state.sampleRate = 0
+	player.state.channels = 0
+}
+
 // play plays a file, directory or playlists
 // Returns error if nothing is to be played
 func (player *musicPlayer) play(playItem string) ([]string, error) {
@@ -249,9 +401,16 @@ func (player *musicPlayer) play(playItem string) ([]string, error) {
 
 	player.stopFlow()
 	player.state.queue = make([]string, 0)
+	player.state.order = nil
 	player.state.current = 0
+	player.resetSignal()
 
 	items, err := player.addPlayItem(playItem)
+	if player.state.shuffle {
+		player.shuffleOrder(false)
+		player.state.current = player.firstIndex()
+	}
+	player.stateChanged()
 	player.Unlock()
 
 	// play all items
@@ -261,90 +420,163 @@ func (player *musicPlayer) play(playItem string) ([]string, error) {
 		go player.playQueue(0, ch)
 		err = <-ch
 	}
+	player.readQueueTags()
 	return items, err
 }
 
 // addPlayItem adds a file, directory or playlist to the play queue
 // Returns the names of the added songs or error if nothing was added
 func (player *musicPlayer) addPlayItem(playItem string) ([]string, error) {
+	entries, err := player.playItemEntries(playItem)
+	if err != nil {
+		return nil, err
+	}
+	return player.addEntries(entries), nil
+}
+
+// playItemEntries finds the songs of a file, directory, playlist, library track or album
+// Only the songs that can be played are returned
+// Returns error if there are none
+func (player *musicPlayer) playItemEntries(playItem string) ([]playlistEntry, error) {
+	// Warning: never call this if the player is not locked
+	// a track of the library can be played by its id and a whole album by the album id
+	if path, ok := player.library.trackPath(playItem); ok {
+		playItem = path
+	}
+	if entries, ok, err := player.albumEntries(playItem); ok {
+		return entries, err
+	}
+	// only the music roots can be played from
+	playItem, err := player.resolveMusicPath(playItem)
+	if err != nil {
+		return nil, err
+	}
 	// is it file or directory
 	fileInfo, err := os.Stat(playItem)
 	if os.IsNotExist(err) {
 		//try it for a playlist
-		fileInfo, err = os.Stat(player.playlistsDir + playItem)
+		playlist, ok := player.playlistPath(playItem)
+		if !ok {
+			return nil, errors.New(file_not_found_msg)
+		}
+		fileInfo, err = os.Stat(playlist)
 		if os.IsNotExist(err) {
 			return nil, errors.New(file_not_found_msg)
 		}
-		playItem = player.playlistsDir + playItem
+		playItem = playlist
 	}
 
-	items := make([]string, 0)
+	entries := make([]playlistEntry, 0)
 
 	switch mode := fileInfo.Mode(); {
 	case mode.IsDir():
-		d, err := os.Open(playItem)
-		if err != nil {
-			return nil, errors.New(file_not_found_msg)
-		}
-		defer d.Close()
-		files, err := d.Readdir(-1)
+		files, err := player.dirFiles(playItem)
 		if err != nil {
 			return nil, errors.New(file_not_found_msg)
 		}
-		prefix := playItem
-		if !strings.HasSuffix(playItem, "/") {
-			prefix = prefix + "/"
-		}
 		for _, file := range files {
-			if file.Mode().IsRegular() {
-				added := player.addRegularFile(prefix + file.Name())
-				items = append(items, added...)
-			}
+			entries = append(entries, player.regularFileEntries(file)...)
 		}
 	case mode.IsRegular():
-		added := player.addRegularFile(playItem)
-		items = append(items, added...)
+		entries = append(entries, player.regularFileEntries(playItem)...)
 
 	}
-	if len(items) == 0 {
+	if len(entries) == 0 {
 		return nil, errors.New(format_not_supported_msg)
 	}
-	return items, nil
+	return entries, nil
+}
+
+// dirFiles returns the files in a directory and all directories in it sorted by path
+// The songs in the music roots are taken from the library and the playlists from the disk. Only the disk is read
+// if the library has not been scanned yet or knows no songs there e.g. a directory that was just created
+// Returns error if the directory cannot be read
+func (player *musicPlayer) dirFiles(dir string) ([]string, error) {
+	// Warning: never call this if the player is not locked
+	if len(player.musicRoots) > 0 {
+		if realDir, err := realPath(dir); err == nil {
+			if files, ok := player.library.dirTracks(realDir); ok && len(files) > 0 {
+				// the library knows only the songs
+				playlists, err := walkFiles(realDir, func(path string) bool {
+					return len(playlistType(path)) > 0
+				})
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, playlists...)
+				sort.Strings(files)
+				return files, nil
+			}
+		}
+	}
+	return walkFiles(dir, func(path string) bool {
+		return true
+	})
+}
+
+// walkFiles returns the regular files in a directory and all directories in it that are accepted by keep
+// Returns error if the directory cannot be read
+func walkFiles(dir string, keep func(path string) bool) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			// unreadable directories are skipped
+			return nil
+		}
+		if info.Mode().IsRegular() && keep(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
 }
 
 // addRegularFile adds a file or playlist items to the play queue
 // Skips the non supported files
 // Returns the names of the added files
 func (player *musicPlayer) addRegularFile(playItem string) []string {
-	items := make([]string, 0)
-	if strings.HasSuffix(playItem, playlistsExtension) {
-		file, err := os.Open(playItem)
+	return player.addEntries(player.regularFileEntries(playItem))
+}
+
+// regularFileEntries returns a file or the items of a playlist with their titles and durations
+// Skips the non supported files
+func (player *musicPlayer) regularFileEntries(playItem string) []playlistEntry {
+	// Warning: never call this if the player is not locked
+	entries := make([]playlistEntry, 0)
+	if len(playlistType(playItem)) > 0 {
+		items, err := readPlaylist(playItem)
 		if err == nil {
-			lastSlash := strings.LastIndex(playItem, "/")
-			path := ""
-			if lastSlash > 0 {
-				path = playItem[:lastSlash+1]
-			}
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				line := scanner.Text()
-				if len(line) > 0 && !strings.HasPrefix(line, "#") {
-					if !strings.Contains(line, "/") {
-						line = path + line
-					}
-					name, err := player.addFile(line)
-					// if file is not suported - simply skip it
-					if err == nil {
-						items = append(items, name)
-					}
+			for _, entry := range items {
+				entry.Path = entryPath(playItem, entry.Path)
+				// if file is not suported - simply skip it
+				if player.checkFile(entry.Path) == nil {
+					entries = append(entries, entry)
 				}
 			}
 		}
-	} else {
-		name, err := player.addFile(playItem)
+	} else if player.checkFile(playItem) == nil {
 		// if file is not suported - simply skip it
-		if err == nil {
-			items = append(items, name)
+		entries = append(entries, playlistEntry{Path: playItem, Duration: -1})
+	}
+	return entries
+}
+
+// addEntries adds songs to the play queue and keeps the titles and durations read from playlists
+// Returns the names of the added songs
+func (player *musicPlayer) addEntries(entries []playlistEntry) []string {
+	// Warning: never call this if the player is not locked
+	items := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name, err := player.addFile(entry.Path)
+		if err != nil {
+			continue
+		}
+		items = append(items, name)
+		if entry.hasInfo() && player.playlistInfo != nil {
+			player.playlistInfo[name] = entry
 		}
 	}
 	return items
@@ -353,15 +585,28 @@ func (player *musicPlayer) addRegularFile(playItem string) []string {
 // addFile adds a single file to the player queue
 // Checks if file type is supported
 func (player *musicPlayer) addFile(fileName string) (string, error) {
+	err := player.checkFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	player.state.queue = append(player.state.queue, fileName)
+	player.addToOrder(len(player.state.queue) - 1)
+	return fileName, nil
+}
+
+// checkFile checks if a file can be played - its type is supported, it exists and is in the music roots
+func (player *musicPlayer) checkFile(fileName string) error {
 	if !isSupportedType(fileName) {
-		return "", errors.New(format_not_supported_msg)
+		return errors.New(format_not_supported_msg)
 	}
 	_, err := os.Stat(fileName)
 	if os.IsNotExist(err) {
-		return "", errors.New(file_not_found_msg)
+		return errors.New(file_not_found_msg)
 	}
-	player.state.queue = append(player.state.queue, fileName)
-	return fileName, nil
+	if !player.isInMusicRoots(fileName) {
+		return errors.New(outside_music_roots_msg)
+	}
+	return nil
 }
 
 // isSupportedType checks if the file type is supported
@@ -387,6 +632,7 @@ func (player *musicPlayer) playQueue(trim float64, ch chan error) {
 	defer player.playQueueMutex.Unlock()
 	play := true
 	first := true
+	failed := 0
 	player.Lock()
 	player.state.status = waiting
 	player.Unlock()
@@ -401,25 +647,55 @@ func (player *musicPlayer) playQueue(trim float64, ch chan error) {
 				fileName = player.state.queue[index]
 			} else {
 				play = false
-				player.state.current = 0
+				player.state.current = player.firstIndex()
 				player.state.status = waiting
+				player.resetSignal()
+				player.publish(Event{Type: eventStopped})
+				player.stateChanged()
 			}
 		}
 		player.Unlock()
 
 		if play && len(fileName) > 0 {
 			fmt.Println("play queue - song to be played ", fileName)
+			var err error
 			if first {
 				first = false
-				player.playSingleFile(fileName, trim, ch)
+				err = player.playSingleFile(fileName, trim, ch)
 			} else {
-				player.playSingleFile(fileName, trim, nil)
+				err = player.playSingleFile(fileName, trim, nil)
 			}
 			trim = 0
 
 			player.Lock()
+			gone := player.state.gone == fileName
 			if player.state.status == waiting {
-				player.state.current += 1
+				// a song that cannot be played is not repeated and
+				// the queue is not repeated forever if no song can be played
+				if err != nil {
+					failed += 1
+					player.publish(Event{Type: eventError, Message: err.Error(), Data: []string{fileName}})
+				} else {
+					failed = 0
+				}
+				index, ok := player.followingIndex(err != nil || gone)
+				if !ok || failed >= len(player.state.queue) {
+					index = len(player.state.queue)
+				}
+				player.state.current = index
+				if gone {
+					player.removeGone()
+				}
+				player.resetSignal()
+				player.stateChanged()
+			} else if gone {
+				// the song was paused or another one was chosen - it cannot be played again
+				player.removeGone()
+				if player.state.current >= len(player.state.queue) {
+					player.state.current = 0
+				}
+				play = false
+				player.stateChanged()
 			}
 			player.Unlock()
 		}
@@ -436,15 +712,19 @@ func (player *musicPlayer) pause() (string, error) {
 		return "", errors.New(cannot_pause_msg)
 	}
 	player.stopFlow()
+	player.publishSong(eventPaused)
+	player.stateChanged()
 	return player.state.queue[player.state.current], nil
 }
 
 // stopFlow deletes all effects in the chain so that flow stops
+// The song that fades out stops too
 func (player *musicPlayer) stopFlow() {
 	// Warning: never call this if the player is not locked
 	if player.state.chain != nil {
 		player.state.chain.DeleteAll()
 	}
+	player.stopFading()
 	player.state.durationPaused = time.Since(player.state.startTime)
 	player.state.status = paused
 }
@@ -477,6 +757,7 @@ func (player *musicPlayer) addToQueue(playItem string) ([]string, error) {
 	player.Lock()
 
 	items, err := player.addPlayItem(playItem)
+	player.stateChanged()
 
 	//start playing if in Waiting status
 	if player.state.status == waiting {
@@ -490,6 +771,7 @@ func (player *musicPlayer) addToQueue(playItem string) ([]string, error) {
 	} else {
 		player.Unlock()
 	}
+	player.readQueueTags()
 
 	return items, err
 }
@@ -502,10 +784,51 @@ func (player *musicPlayer) stop() {
 		if player.state.chain != nil {
 			player.state.chain.DeleteAll()
 		}
+		player.stopFading()
+		player.releasePrepared()
 		player.state.status = paused
 		player.state.current = 0
 		player.state.queue = make([]string, 0)
+		player.state.order = nil
+		player.resetSignal()
+		player.publish(Event{Type: eventStopped})
+		player.stateChanged()
+	}
+}
+
+// stopKeepingQueue stops the playback without clearing the queue
+// The current song is played from the beginning the next time
+func (player *musicPlayer) stopKeepingQueue() {
+	player.Lock()
+	if player.state.status == playing {
+		player.stopFlow()
+	}
+	player.Unlock()
+
+	// wait for the chain to be released before the song is forgotten
+	player.waitEnd()
+
+	player.Lock()
+	defer player.Unlock()
+	if player.state.status == waiting {
+		return
 	}
+	player.state.status = waiting
+	player.state.durationPaused = 0
+	player.resetSignal()
+	player.publish(Event{Type: eventStopped})
+	player.stateChanged()
+}
+
+// appendToQueue adds a file, directory or playlist to the queue without starting the playback
+// Returns added songs or error if nothing was added
+func (player *musicPlayer) appendToQueue(playItem string) ([]string, error) {
+	player.Lock()
+	items, err := player.addPlayItem(playItem)
+	player.stateChanged()
+	player.Unlock()
+	player.readQueueTags()
+	return items, err
 }
 
 // next plays the next song from the queue
@@ -513,13 +836,13 @@ func (player *musicPlayer) stop() {
 func (player *musicPlayer) next() (string, error) {
 	player.Lock()
 	var songToResume string
-	if player.state.current < len(player.state.queue)-1 {
+	if index, ok := player.followingIndex(true); ok {
 		if player.state.status == playing {
 			player.stopFlow()
 		}
-		player.state.current += 1
+		player.state.current = index
 		songToResume = player.state.queue[player.state.current]
-
+		player.stateChanged()
 	} else {
 		player.Unlock()
 		return songToResume, errors.New(cannot_next_msg)
@@ -539,12 +862,13 @@ func (player *musicPlayer) next() (string, error) {
 func (player *musicPlayer) previous() (string, error) {
 	player.Lock()
 	var songToResume string
-	if player.state.current > 0 {
+	if index, ok := player.precedingIndex(); ok {
 		if player.state.status == playing {
 			player.stopFlow()
 		}
-		player.state.current -= 1
+		player.state.current = index
 		songToResume = player.state.queue[player.state.current]
+		player.stateChanged()
 	} else {
 		player.Unlock()
 		return songToResume, errors.New(cannot_previous_msg)
@@ -559,50 +883,71 @@ func (player *musicPlayer) previous() (string, error) {
 	return songToResume, err
 }
 
-// getCurrentSongInfo gets the name of the current song
-// Returns the name of the current song or error if there is no current song
-func (player *musicPlayer) getCurrentSongInfo() (string, error) {
+// getCurrentSongInfo gets the info about the current song
+// Returns the name, status, elapsed time, duration, queue index and signal of the current song
+// or error if there is no current song
+func (player *musicPlayer) getCurrentSongInfo() (SongInfo, error) {
 	player.Lock()
 	defer player.Unlock()
+	return player.songInfo()
+}
+
+// songInfo gets the info about the current song
+// Returns error if there is no current song
+func (player *musicPlayer) songInfo() (SongInfo, error) {
+	// Warning: never call this if the player is not locked
 	if player.state.current < len(player.state.queue) {
-		return player.state.queue[player.state.current], nil
+		name := player.state.queue[player.state.current]
+		info := SongInfo{
+			Name:       name,
+			Status:     statusNames[player.state.status],
+			Elapsed:    player.elapsed().Seconds(),
+			Duration:   player.state.duration.Seconds(),
+			Index:      player.state.current,
+			SampleRate: player.state.sampleRate,
+			Channels:   player.state.channels,
+		}
+		if tags := player.songTags(name); !tags.isEmpty() {
+			info.Tags = &tags
+		}
+		return info, nil
 	}
-	return "", errors.New(cannot_get_info_msg)
+	return SongInfo{}, errors.New(cannot_get_info_msg)
 }
 
 // saveAsPlaylist saves the contents of the queue as a playlist
+// The extension of the name picks the type - .m3u8, .pls, .xspf or .m3u if it has none of them
 // Returns the name of the playlist or an error if the playlist could not be saved
 func (player *musicPlayer) saveAsPlaylist(playlistName string) (string, error) {
-	songs, err := player.getQueueInfo()
-	if err != nil {
+	player.Lock()
+	if len(player.state.queue) == 0 {
+		player.Unlock()
 		return "", errors.New(cannot_save_empty_queue_msg)
 	}
+	entries := player.playlistEntries()
+	player.Unlock()
 
 	if strings.Contains(playlistName, "/") {
 		return "", errors.New(cannot_save_playlist_msg)
 	}
 
 	// check the directory
-	_, err = os.Stat(player.playlistsDir)
+	_, err := os.Stat(player.playlistsDir)
 	if os.IsNotExist(err) {
 		os.Mkdir(player.playlistsDir, 0777)
 	}
 
-	// now create the file
+	// now create the file, the extension picks the type of the playlist
 	name := playlistName
-	if !strings.HasSuffix(playlistName, playlistsExtension) {
+	if len(playlistType(playlistName)) == 0 {
 		name = playlistName + playlistsExtension
 	}
-	file, err := os.Create(player.playlistsDir + name)
+	player.playlistsMutex.Lock()
+	err = writePlaylist(player.playlistsDir+name, entries)
+	player.playlistsMutex.Unlock()
 	if err != nil {
 		return "", errors.New(cannot_save_playlist_msg)
 	}
-	// https://en.wikipedia.org/wiki/M3U#File_format
-	// using the non extended format
-	for _, song := range songs {
-		file.WriteString(song)
-		file.WriteString("\n")
-	}
 	return name, nil
 }
 
@@ -628,7 +973,7 @@ func (player *musicPlayer) listPlaylists() ([]string, error) {
 	}
 
 	for _, file := range files {
-		if file.Mode().IsRegular() && strings.HasSuffix(file.Name(), playlistsExtension) {
+		if file.Mode().IsRegular() && len(playlistType(file.Name())) > 0 {
 			playlists = append(playlists, file.Name())
 		}
 	}
@@ -641,17 +986,43 @@ func (player *musicPlayer) listPlaylists() ([]string, error) {
 // getQueueInfo gets the queue info
 // Returns all filenames that are currently in the queue or error if queue is empty
 func (player *musicPlayer) getQueueInfo() ([]string, error) {
+	songs, _, err := player.getQueueDetails()
+	return songs, err
+}
+
+// getQueueDetails gets the queue info together with the current song, modes and play order
+// Returns all filenames that are currently in the queue and their details or error if queue is empty
+func (player *musicPlayer) getQueueDetails() ([]string, QueueInfo, error) {
 	player.Lock()
 	defer player.Unlock()
+	return player.queueDetails()
+}
+
+// queueDetails gets the songs in the queue, the current song, modes and play order
+// Returns error if queue is empty
+func (player *musicPlayer) queueDetails() ([]string, QueueInfo, error) {
+	// Warning: never call this if the player is not locked
 	if len(player.state.queue) == 0 {
-		return nil, errors.New(cannot_get_queue_info_msg)
+		return nil, QueueInfo{}, errors.New(cannot_get_queue_info_msg)
 	}
 	//make a copy to the queue
-	copy := make([]string, 0, len(player.state.queue))
+	songs := make([]string, 0, len(player.state.queue))
+	tags := make([]Tags, 0, len(player.state.queue))
+	tagged := false
 	for _, el := range player.state.queue {
-		copy = append(copy, el)
+		songs = append(songs, el)
+		songTags := player.songTags(el)
+		tags = append(tags, songTags)
+		tagged = tagged || !songTags.isEmpty()
 	}
-	return copy, nil
+	info := QueueInfo{ModeInfo: player.modeInfo(), Current: player.state.current}
+	if player.state.shuffle {
+		info.Order = append([]int{}, player.playOrder()...)
+	}
+	if tagged {
+		info.Tags = tags
+	}
+	return songs, info, nil
 }
 
 // start playing song with index 'number' from the queue
@@ -671,6 +1042,7 @@ func (player *musicPlayer) jump(number string) (string, error) {
 		}
 		player.state.current = i
 		songToResume = player.state.queue[player.state.current]
+		player.stateChanged()
 
 	} else {
 		player.Unlock()
@@ -685,3 +1057,68 @@ func (player *musicPlayer) jump(number string) (string, error) {
 
 	return songToResume, err
 }
+
+// elapsed returns how far the current song has been played
+func (player *musicPlayer) elapsed() time.Duration {
+	// Warning: never call this if the player is not locked
+	switch player.state.status {
+	case playing:
+		return time.Since(player.state.startTime)
+	case paused:
+		return player.state.durationPaused
+	}
+	return 0
+}
+
+// seek moves to a position within the current song
+// position is either absolute in seconds ("42") or relative to the current position ("+30", "-10")
+// A paused song stays paused and resumes from the new position
+// Returns the name of the song or error if there is no current song or position is invalid or past the end of the song
+func (player *musicPlayer) seek(position string) (string, error) {
+	player.Lock()
+	var songToResume string
+	seconds, err := strconv.ParseFloat(position, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		player.Unlock()
+		return songToResume, errors.New(invalid_seek_position_msg)
+	}
+
+	if player.state.current >= len(player.state.queue) ||
+		(player.state.status != playing && player.state.status != paused) {
+		player.Unlock()
+		return songToResume, errors.New(cannot_seek_msg)
+	}
+
+	if strings.HasPrefix(position, "+") || strings.HasPrefix(position, "-") {
+		seconds += player.elapsed().Seconds()
+	}
+	if seconds < 0 {
+		seconds = 0
+	}
+	if player.state.duration > 0 && seconds > player.state.duration.Seconds() {
+		player.Unlock()
+		return songToResume, errors.New(invalid_seek_position_msg)
+	}
+	songToResume = player.state.queue[player.state.current]
+
+	if player.state.status == paused {
+		player.state.durationPaused = time.Duration(seconds * float64(time.Second))
+		player.stateChanged()
+		player.Unlock()
+		return songToResume, nil
+	}
+
+	// rebuild the chain trimmed at the new position
+	player.stopFlow()
+	player.Unlock()
+	return songToResume, player.playFrom(seconds)
+}
+
+// playFrom plays the queue from the current song trimmed at position (in seconds)
+// Returns error if the current song could not be played
+func (player *musicPlayer) playFrom(position float64) error {
+	ch := make(chan error)
+	defer close(ch)
+	go player.playQueue(position, ch)
+	return <-ch
+}
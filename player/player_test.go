@@ -13,6 +13,20 @@ func getTestPlaylistDir() string {
 	return "test_playlists/"
 }
 
+// initTestPlayer creates a new player that is not playing with the test playlists
+// Music can be played only from the roots if any are given
+func initTestPlayer(t *testing.T, roots ...string) {
+	player = musicPlayer{playQueueMutex: &sync.Mutex{}}
+	err := player.init(getTestPlaylistDir())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = player.setMusicRoots(roots)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
 func TestMain(m *testing.M) {
 	sox.Init()
 	code := m.Run()
@@ -496,3 +510,29 @@ func TestPlayPauseResumePause(t *testing.T) {
 	player.pause()
 	checkDuration(t, 2, 2.1, player.state.durationPaused.Seconds())
 }
+
+func TestSeekPaused(t *testing.T) {
+	fmt.Println("TestSeekPaused")
+	initTestPlayer(t)
+	defer player.waitEnd()
+	player.play("test_sounds/beep28.mp3")
+	time.Sleep(1 * time.Second)
+	player.pause()
+	_, err := player.seek("+1.5")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkDuration(t, 2.5, 2.6, player.state.durationPaused.Seconds())
+	player.seek("-10")
+	checkDuration(t, 0, 0, player.state.durationPaused.Seconds())
+	player.seek("2")
+	checkDuration(t, 2, 2, player.state.durationPaused.Seconds())
+	// the position cannot be past the end of the song
+	_, err = player.seek("+10")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, invalid_seek_position_msg, err.Error())
+	checkDuration(t, 2, 2, player.state.durationPaused.Seconds())
+	player.stop()
+}
@@ -0,0 +1,340 @@
+package player
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// playlistEntry is a song of a playlist with its duration and title if the playlist has them
+// The duration is in seconds, -1 if it is not known
+type playlistEntry struct {
+	Path     string
+	Duration float64
+	Title    string
+}
+
+// hasInfo checks if the entry has a duration or a title
+func (entry playlistEntry) hasInfo() bool {
+	return entry.Duration >= 0 || len(entry.Title) > 0
+}
+
+// readM3U reads the entries of a M3U or M3U8 playlist - plain or extended with #EXTM3U and #EXTINF lines
+// M3U8 is UTF-8. M3U is read as UTF-8 too, but the lines that are not valid UTF-8 are read as Latin-1
+// like the legacy playlists are written (legacy is true for M3U)
+// https://en.wikipedia.org/wiki/M3U#Extended_M3U
+// The other comments and directives are skipped
+func readM3U(reader io.Reader, legacy bool) []playlistEntry {
+	entries := make([]playlistEntry, 0)
+	info := playlistEntry{Duration: -1}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if legacy && !utf8.ValidString(text) {
+			text = latin1(scanner.Bytes())
+		}
+		line := strings.TrimSpace(strings.TrimPrefix(text, "\ufeff"))
+		switch {
+		case len(line) == 0:
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info = parseExtInf(line[len("#EXTINF:"):])
+		case strings.HasPrefix(line, "#"):
+			// #EXTM3U and the directives of other players
+		default:
+			info.Path = line
+			entries = append(entries, info)
+			info = playlistEntry{Duration: -1}
+		}
+	}
+	return entries
+}
+
+// parseExtInf parses the duration and the title of an #EXTINF line e.g. 123,Artist - Title
+// The attributes some players put after the duration e.g. tvg-id="..." are skipped
+func parseExtInf(value string) playlistEntry {
+	entry := playlistEntry{Duration: -1}
+	attributes := value
+	if i := strings.Index(value, ","); i >= 0 {
+		attributes = value[:i]
+		entry.Title = strings.TrimSpace(value[i+1:])
+	}
+	fields := strings.Fields(attributes)
+	if len(fields) > 0 {
+		duration, err := strconv.ParseFloat(fields[0], 64)
+		if err == nil && duration >= 0 {
+			entry.Duration = duration
+		}
+	}
+	return entry
+}
+
+// entryPath returns the path of a playlist entry. Names without a directory are in the directory of the playlist
+func entryPath(playlist string, name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return filepath.Join(filepath.Dir(playlist), name)
+}
+
+// formatDuration formats the duration of an entry in seconds, -1 if it is not known
+func formatDuration(duration float64) string {
+	if duration < 0 {
+		return "-1"
+	}
+	return strconv.FormatFloat(duration, 'f', -1, 64)
+}
+
+// writeM3U writes the entries as an extended M3U playlist
+// The #EXTINF line is left out for the entries without a duration and a title
+func writeM3U(writer io.Writer, entries []playlistEntry) error {
+	buffer := bufio.NewWriter(writer)
+	buffer.WriteString("#EXTM3U\n")
+	for _, entry := range entries {
+		if entry.hasInfo() {
+			fmt.Fprintf(buffer, "#EXTINF:%s,%s\n", formatDuration(entry.Duration), entry.Title)
+		}
+		buffer.WriteString(entry.Path)
+		buffer.WriteString("\n")
+	}
+	return buffer.Flush()
+}
+
+// readPLS reads the entries of a PLS playlist in the order of their numbers
+// https://en.wikipedia.org/wiki/PLS_(file_format)
+func readPLS(reader io.Reader) []playlistEntry {
+	entries := make(map[int]*playlistEntry)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			// [playlist] and the lines that are not key=value
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])
+		field := strings.TrimRight(key, "0123456789")
+		number, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			// NumberOfEntries and Version
+			continue
+		}
+		entry, ok := entries[number]
+		if !ok {
+			entry = &playlistEntry{Duration: -1}
+			entries[number] = entry
+		}
+		switch field {
+		case "file":
+			entry.Path = value
+		case "title":
+			entry.Title = value
+		case "length":
+			if duration, err := strconv.ParseFloat(value, 64); err == nil && duration >= 0 {
+				entry.Duration = duration
+			}
+		}
+	}
+	numbers := make([]int, 0, len(entries))
+	for number := range entries {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	list := make([]playlistEntry, 0, len(numbers))
+	for _, number := range numbers {
+		// titles and lengths without a file are skipped
+		if len(entries[number].Path) > 0 {
+			list = append(list, *entries[number])
+		}
+	}
+	return list
+}
+
+// writePLS writes the entries as a PLS playlist
+func writePLS(writer io.Writer, entries []playlistEntry) error {
+	buffer := bufio.NewWriter(writer)
+	buffer.WriteString("[playlist]\n")
+	for i, entry := range entries {
+		fmt.Fprintf(buffer, "File%d=%s\n", i+1, entry.Path)
+		if len(entry.Title) > 0 {
+			fmt.Fprintf(buffer, "Title%d=%s\n", i+1, entry.Title)
+		}
+		fmt.Fprintf(buffer, "Length%d=%s\n", i+1, formatDuration(entry.Duration))
+	}
+	fmt.Fprintf(buffer, "NumberOfEntries=%d\nVersion=2\n", len(entries))
+	return buffer.Flush()
+}
+
+// xspfPlaylist is a XSPF playlist https://www.xspf.org/spec
+// Only the location, the title, the creator and the duration (in milliseconds) of the tracks are used
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Version string      `xml:"version,attr"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Duration string `xml:"duration,omitempty"`
+}
+
+// readXSPF reads the entries of a XSPF playlist
+// The locations are file URIs or URIs relative to the playlist and are turned into paths
+// Returns error if the playlist is not valid XML
+func readXSPF(reader io.Reader) ([]playlistEntry, error) {
+	playlist := xspfPlaylist{}
+	err := xml.NewDecoder(reader).Decode(&playlist)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]playlistEntry, 0, len(playlist.Tracks))
+	for _, track := range playlist.Tracks {
+		location, err := url.Parse(strings.TrimSpace(track.Location))
+		if err != nil || (len(location.Scheme) > 0 && location.Scheme != "file") || len(location.Path) == 0 {
+			// streams are not supported
+			continue
+		}
+		entry := playlistEntry{Path: location.Path, Duration: -1, Title: strings.TrimSpace(track.Title)}
+		if creator := strings.TrimSpace(track.Creator); len(creator) > 0 && len(entry.Title) > 0 {
+			entry.Title = creator + " - " + entry.Title
+		}
+		if duration, err := strconv.ParseInt(strings.TrimSpace(track.Duration), 10, 64); err == nil && duration >= 0 {
+			entry.Duration = float64(duration) / 1000
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// writeXSPF writes the entries as a XSPF playlist. Absolute paths are written as file URIs
+func writeXSPF(writer io.Writer, entries []playlistEntry) error {
+	playlist := xspfPlaylist{Xmlns: "http://xspf.org/ns/0/", Version: "1", Tracks: make([]xspfTrack, 0, len(entries))}
+	for _, entry := range entries {
+		location := url.URL{Path: entry.Path}
+		if filepath.IsAbs(entry.Path) {
+			location.Scheme = "file"
+		}
+		track := xspfTrack{Location: location.String()}
+		tags := titleTags(entry.Title)
+		track.Title, track.Creator = tags.Title, tags.Artist
+		if entry.Duration >= 0 {
+			track.Duration = strconv.FormatInt(int64(math.Round(entry.Duration*1000)), 10)
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	io.WriteString(writer, xml.Header)
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(playlist)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, "\n")
+	return err
+}
+
+// playlistType returns the extension of a supported playlist in lower case or empty string if it is not a playlist
+func playlistType(name string) string {
+	extension := strings.ToLower(filepath.Ext(name))
+	if contains(playlistExtensions, extension) {
+		return extension
+	}
+	return ""
+}
+
+// readPlaylist reads the entries of a playlist of any of the supported types
+// Returns error if the playlist cannot be read
+func readPlaylist(path string) ([]playlistEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	switch playlistType(path) {
+	case ".m3u", ".m3u8":
+		return readM3U(file, playlistType(path) == ".m3u"), nil
+	case ".pls":
+		return readPLS(file), nil
+	case ".xspf":
+		return readXSPF(file)
+	}
+	return nil, errors.New(format_not_supported_msg)
+}
+
+// writePlaylist writes the entries as a playlist of the type of its extension
+// The playlist is replaced at once so that a failed write never destroys it
+// Returns error if the playlist cannot be written
+func writePlaylist(path string, entries []playlistEntry) error {
+	tmpFile := path + ".tmp"
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	switch playlistType(path) {
+	case ".pls":
+		err = writePLS(file, entries)
+	case ".xspf":
+		err = writeXSPF(file, entries)
+	default:
+		err = writeM3U(file, entries)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
+
+// titleTags turns the title of a playlist entry into tags. "Artist - Title" is split into the artist and the title
+func titleTags(title string) Tags {
+	if i := strings.Index(title, " - "); i > 0 {
+		return Tags{Artist: strings.TrimSpace(title[:i]), Title: strings.TrimSpace(title[i+3:])}
+	}
+	return Tags{Title: title}
+}
+
+// playlistEntries describes the songs in the queue for saving them as a playlist
+// The title and the duration of the entries the songs were read from are kept,
+// the others are taken from the tags and the library
+func (player *musicPlayer) playlistEntries() []playlistEntry {
+	// Warning: never call this if the player is not locked
+	entries := make([]playlistEntry, 0, len(player.state.queue))
+	for _, song := range player.state.queue {
+		entry, ok := player.playlistInfo[song]
+		if !ok {
+			entry = playlistEntry{Duration: -1}
+		}
+		entry.Path = song
+		if len(entry.Title) == 0 {
+			tags := player.songTags(song)
+			entry.Title = tags.Title
+			if len(tags.Title) > 0 && len(tags.Artist) > 0 {
+				entry.Title = tags.Artist + " - " + tags.Title
+			}
+		}
+		if entry.Duration < 0 {
+			player.library.Lock()
+			if track, ok := player.library.tracks[song]; ok && track.Duration > 0 {
+				entry.Duration = math.Round(track.Duration)
+			}
+			player.library.Unlock()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
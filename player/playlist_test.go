@@ -0,0 +1,256 @@
+package player
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReadM3U(t *testing.T) {
+	fmt.Println("TestReadM3U")
+	entries := readM3U(strings.NewReader("\ufeff#EXTM3U\r\n"+
+		"#EXTINF:123,Tester - Beep\r\n"+
+		"beep9.mp3\r\n"+
+		"\r\n"+
+		"# a comment\r\n"+
+		"beep28.mp3\r\n"+
+		"#EXTINF:-1 tvg-id=\"x\",Just a title\r\n"+
+		"#EXTGRP:Beeps\r\n"+
+		"sub/beep36.mp3\r\n"), false)
+	checkInt(t, 3, len(entries))
+	checkStr(t, "beep9.mp3", entries[0].Path)
+	checkStr(t, "Tester - Beep", entries[0].Title)
+	checkStr(t, "123", fmt.Sprint(entries[0].Duration))
+	checkStr(t, "beep28.mp3", entries[1].Path)
+	if entries[1].hasInfo() {
+		t.Errorf("Expected no info for a plain entry, got %v", entries[1])
+	}
+	checkStr(t, "sub/beep36.mp3", entries[2].Path)
+	checkStr(t, "Just a title", entries[2].Title)
+	checkStr(t, "-1", fmt.Sprint(entries[2].Duration))
+}
+
+func TestReadLegacyM3U(t *testing.T) {
+	fmt.Println("TestReadLegacyM3U")
+	playlist := "#EXTINF:1,Bj\xf6rk - J\xf3ga\nsongs/J\xf3ga.mp3\nsongs/Ma\xc3\xb1ana.mp3\n"
+	entries := readM3U(strings.NewReader(playlist), true)
+	checkInt(t, 2, len(entries))
+	checkStr(t, "Björk - Jóga", entries[0].Title)
+	checkStr(t, "songs/Jóga.mp3", entries[0].Path)
+	checkStr(t, "songs/Mañana.mp3", entries[1].Path)
+
+	// M3U8 is always UTF-8
+	entries = readM3U(strings.NewReader(playlist), false)
+	checkStr(t, "songs/Mañana.mp3", entries[1].Path)
+	if entries[0].Path == "songs/Jóga.mp3" {
+		t.Errorf("Expected Latin-1 not to be decoded in M3U8")
+	}
+}
+
+func TestWritePlaylistKeepsOldOnError(t *testing.T) {
+	fmt.Println("TestWritePlaylistKeepsOldOnError")
+	dir, err := ioutil.TempDir("", "music_player_playlists")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keep.m3u")
+	entries := []playlistEntry{{Path: "beep9.mp3", Duration: -1}}
+	err = writePlaylist(path, entries)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the temporary file cannot be created
+	os.Mkdir(path+".tmp", 0777)
+	err = writePlaylist(path, nil)
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+	found, err := readPlaylist(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, fmt.Sprint(entries), fmt.Sprint(found))
+}
+
+func TestWriteM3U(t *testing.T) {
+	fmt.Println("TestWriteM3U")
+	entries := []playlistEntry{
+		{Path: "beep9.mp3", Duration: 123, Title: "Tester - Beep"},
+		{Path: "beep28.mp3", Duration: -1},
+		{Path: "beep36.mp3", Duration: -1, Title: "Just a title"},
+		{Path: "beep1.mp3", Duration: 1.5},
+	}
+	buffer := &strings.Builder{}
+	err := writeM3U(buffer, entries)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "#EXTM3U\n#EXTINF:123,Tester - Beep\nbeep9.mp3\nbeep28.mp3\n"+
+		"#EXTINF:-1,Just a title\nbeep36.mp3\n#EXTINF:1.5,\nbeep1.mp3\n", buffer.String())
+	checkStr(t, fmt.Sprint(entries), fmt.Sprint(readM3U(strings.NewReader(buffer.String()), false)))
+}
+
+func TestTitleTags(t *testing.T) {
+	fmt.Println("TestTitleTags")
+	checkStr(t, fmt.Sprint(Tags{Artist: "Tester", Title: "Beep - Remix"}), fmt.Sprint(titleTags("Tester - Beep - Remix")))
+	checkStr(t, fmt.Sprint(Tags{Title: "Beep"}), fmt.Sprint(titleTags("Beep")))
+}
+
+func TestExtendedPlaylistRoundTrip(t *testing.T) {
+	fmt.Println("TestExtendedPlaylistRoundTrip")
+	dir, err := ioutil.TempDir("", "music_player_playlists")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	initTestPlayer(t)
+	player.playlistsDir = dir + "/"
+	content := "#EXTM3U\n" +
+		"#EXTINF:2,Tester - Beep\n" +
+		"test_sounds/beep9.mp3\n" +
+		"test_sounds/beep28.mp3\n" +
+		"#EXTINF:-1,Untagged\n" +
+		"test_pl_short_names/beep9.mp3\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "extended.m3u"), []byte(content), 0666)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	player.Lock()
+	items := player.addRegularFile(filepath.Join(dir, "extended.m3u"))
+	checkInt(t, 3, len(items))
+	// the titles are shown for the songs without tags
+	checkStr(t, fmt.Sprint(Tags{Artist: "Tester", Title: "Beep"}), fmt.Sprint(player.songTags(items[0])))
+	checkStr(t, fmt.Sprint(Tags{}), fmt.Sprint(player.songTags(items[1])))
+	checkStr(t, fmt.Sprint(Tags{Title: "Untagged"}), fmt.Sprint(player.songTags(items[2])))
+	player.Unlock()
+
+	name, err := player.saveAsPlaylist("saved")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "saved.m3u", name)
+	saved, err := ioutil.ReadFile(filepath.Join(dir, "saved.m3u"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, content, string(saved))
+}
+
+func TestReadPLS(t *testing.T) {
+	fmt.Println("TestReadPLS")
+	entries := readPLS(strings.NewReader("[playlist]\r\n" +
+		"File2=beep28.mp3\r\n" +
+		"Title1=Tester - Beep\r\n" +
+		"File1=beep9.mp3\r\n" +
+		"Length1=2\r\n" +
+		"Length2=-1\r\n" +
+		"Title3=No file\r\n" +
+		"NumberOfEntries=2\r\n" +
+		"Version=2\r\n"))
+	checkStr(t, fmt.Sprint([]playlistEntry{
+		{Path: "beep9.mp3", Duration: 2, Title: "Tester - Beep"},
+		{Path: "beep28.mp3", Duration: -1},
+	}), fmt.Sprint(entries))
+}
+
+func TestReadXSPF(t *testing.T) {
+	fmt.Println("TestReadXSPF")
+	entries, err := readXSPF(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Beeps</title>
+  <trackList>
+    <track>
+      <location>file:///music/Tester/01%20Beep.mp3</location>
+      <title>Beep</title>
+      <creator>Tester</creator>
+      <album>Beeps</album>
+      <duration>2500</duration>
+    </track>
+    <track><location>beep9.mp3</location></track>
+    <track><location>http://example.com/stream.mp3</location></track>
+  </trackList>
+</playlist>`))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, fmt.Sprint([]playlistEntry{
+		{Path: "/music/Tester/01 Beep.mp3", Duration: 2.5, Title: "Tester - Beep"},
+		{Path: "beep9.mp3", Duration: -1},
+	}), fmt.Sprint(entries))
+
+	_, err = readXSPF(strings.NewReader("not xml"))
+	if err == nil {
+		t.Errorf("Expected error for a broken playlist")
+	}
+}
+
+func TestWritePlaylistTypes(t *testing.T) {
+	fmt.Println("TestWritePlaylistTypes")
+	dir, err := ioutil.TempDir("", "music_player_playlists")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	entries := []playlistEntry{
+		{Path: "/music/Tester/01 Beep.mp3", Duration: 2.5, Title: "Tester - Beep"},
+		{Path: "beep9.mp3", Duration: -1, Title: "Untagged"},
+		{Path: "beep28.mp3", Duration: -1},
+	}
+	for _, name := range []string{"list.m3u", "list.m3u8", "list.pls", "list.xspf"} {
+		path := filepath.Join(dir, name)
+		err := writePlaylist(path, entries)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		read, err := readPlaylist(path)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		checkStr(t, fmt.Sprint(entries), fmt.Sprint(read))
+	}
+	_, err = readPlaylist(filepath.Join(dir, "missing.pls"))
+	if err == nil {
+		t.Errorf("Expected error for a missing playlist")
+	}
+}
+
+func TestPlaylistTypes(t *testing.T) {
+	fmt.Println("TestPlaylistTypes")
+	dir, err := ioutil.TempDir("", "music_player_playlists")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	initTestPlayer(t)
+	player.playlistsDir = dir + "/"
+	player.Lock()
+	player.addRegularFile("test_playlists/sample_playlist.m3u")
+	player.Unlock()
+
+	for _, name := range []string{"saved.M3U8", "saved.pls", "saved.xspf", "saved"} {
+		_, err := player.saveAsPlaylist(name)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a playlist"), 0666)
+	playlists, err := player.listPlaylists()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sort.Strings(playlists)
+	checkStr(t, "[saved.M3U8 saved.m3u saved.pls saved.xspf]", fmt.Sprint(playlists))
+
+	for _, name := range playlists {
+		player.Lock()
+		items := player.addRegularFile(filepath.Join(dir, name))
+		player.Unlock()
+		checkStr(t, "[test_sounds/beep9.mp3 test_sounds/beep28.mp3 test_sounds/beep36.mp3]", fmt.Sprint(items))
+	}
+}
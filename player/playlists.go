@@ -0,0 +1,219 @@
+package player
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PlaylistEntryInfo describes a song of a saved playlist
+// The title and the duration are the ones in the playlist, the tags are read from the song
+type PlaylistEntryInfo struct {
+	Name     string
+	Title    string  `json:"Title,omitempty"`
+	Duration float64 `json:"Duration,omitempty"`
+	Tags     *Tags   `json:"Tags,omitempty"`
+	// the song cannot be found
+	Missing bool `json:"Missing,omitempty"`
+}
+
+// savedPlaylist returns the path of a saved playlist
+// Returns error if there is no such playlist in the playlists directory
+func (player *musicPlayer) savedPlaylist(name string) (string, error) {
+	path, ok := player.playlistPath(name)
+	if !ok || strings.Contains(name, "/") || len(playlistType(name)) == 0 {
+		return "", errors.New(playlist_not_found_msg)
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil || !fileInfo.Mode().IsRegular() {
+		return "", errors.New(playlist_not_found_msg)
+	}
+	return path, nil
+}
+
+// editPlaylist reads a saved playlist, changes its entries with edit and writes it back
+// The entries keep their names as they are written in the playlist
+// Returns the result of edit or error if the playlist cannot be found or saved
+func (player *musicPlayer) editPlaylist(name string,
+	edit func(path string, entries []playlistEntry) ([]playlistEntry, []string, error)) ([]string, error) {
+	player.playlistsMutex.Lock()
+	defer player.playlistsMutex.Unlock()
+	path, err := player.savedPlaylist(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readPlaylist(path)
+	if err != nil {
+		return nil, errors.New(playlist_not_found_msg)
+	}
+	entries, items, err := edit(path, entries)
+	if err != nil {
+		return nil, err
+	}
+	if writePlaylist(path, entries) != nil {
+		return nil, errors.New(cannot_save_playlist_msg)
+	}
+	return items, nil
+}
+
+// getPlaylist lists the songs of a saved playlist with their titles, durations and tags
+// Returns the file names and the entries or error if there is no such playlist
+func (player *musicPlayer) getPlaylist(name string) ([]string, []PlaylistEntryInfo, error) {
+	player.playlistsMutex.Lock()
+	path, err := player.savedPlaylist(name)
+	if err != nil {
+		player.playlistsMutex.Unlock()
+		return nil, nil, err
+	}
+	entries, err := readPlaylist(path)
+	player.playlistsMutex.Unlock()
+	if err != nil {
+		return nil, nil, errors.New(playlist_not_found_msg)
+	}
+
+	names := make([]string, 0, len(entries))
+	infos := make([]PlaylistEntryInfo, 0, len(entries))
+	for _, entry := range entries {
+		song := entryPath(path, entry.Path)
+		info := PlaylistEntryInfo{Name: filepath.Base(song), Title: entry.Title}
+		if entry.Duration > 0 {
+			info.Duration = entry.Duration
+		}
+		if _, err := os.Stat(song); err != nil {
+			info.Missing = true
+		} else if tags, err := readTags(song); err == nil {
+			info.Tags = &tags
+		}
+		names = append(names, song)
+		infos = append(infos, info)
+	}
+	return names, infos, nil
+}
+
+// deletePlaylist deletes a saved playlist
+// Returns the name of the playlist or error if there is no such playlist
+func (player *musicPlayer) deletePlaylist(name string) (string, error) {
+	player.playlistsMutex.Lock()
+	defer player.playlistsMutex.Unlock()
+	path, err := player.savedPlaylist(name)
+	if err != nil {
+		return "", err
+	}
+	if os.Remove(path) != nil {
+		return "", errors.New(cannot_delete_playlist_msg)
+	}
+	return name, nil
+}
+
+// renamePlaylist renames a saved playlist. The playlist is converted if the new name has another extension
+// and keeps its type if the new name has no playlist extension
+// Returns the new name or error if there is no such playlist or the new name is taken or invalid
+func (player *musicPlayer) renamePlaylist(name string, newName string) (string, error) {
+	player.playlistsMutex.Lock()
+	defer player.playlistsMutex.Unlock()
+	path, err := player.savedPlaylist(name)
+	if err != nil {
+		return "", err
+	}
+	if len(playlistType(newName)) == 0 {
+		newName = newName + filepath.Ext(name)
+	}
+	newPath, ok := player.playlistPath(newName)
+	if !ok || len(strings.TrimSuffix(newName, filepath.Ext(newName))) == 0 || strings.Contains(newName, "/") {
+		return "", errors.New(cannot_rename_playlist_msg)
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return "", errors.New(playlist_exists_msg)
+	}
+
+	if playlistType(name) == playlistType(newName) {
+		if os.Rename(path, newPath) != nil {
+			return "", errors.New(cannot_rename_playlist_msg)
+		}
+		return newName, nil
+	}
+	entries, err := readPlaylist(path)
+	if err != nil {
+		return "", errors.New(playlist_not_found_msg)
+	}
+	if writePlaylist(newPath, entries) != nil {
+		os.Remove(newPath)
+		return "", errors.New(cannot_rename_playlist_msg)
+	}
+	os.Remove(path)
+	return newName, nil
+}
+
+// addToPlaylist appends a file, directory, playlist, library track or album to a saved playlist
+// The queue is not changed
+// Returns the names of the added songs or error if there is no such playlist or nothing can be added
+func (player *musicPlayer) addToPlaylist(name string, playItem string) ([]string, error) {
+	player.Lock()
+	added, err := player.playItemEntries(playItem)
+	player.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return player.editPlaylist(name, func(path string, entries []playlistEntry) ([]playlistEntry, []string, error) {
+		items := make([]string, 0, len(added))
+		for i, entry := range added {
+			if !strings.Contains(entry.Path, "/") {
+				// a name without a directory would be looked up in the playlists directory
+				if abs, err := filepath.Abs(entry.Path); err == nil {
+					added[i].Path = abs
+				}
+			}
+			items = append(items, added[i].Path)
+		}
+		return append(entries, added...), items, nil
+	})
+}
+
+// parsePlaylistIndex converts the index of an entry in a playlist
+// Returns false if there is no such entry
+func parsePlaylistIndex(number string, entries []playlistEntry) (int, bool) {
+	i, err := strconv.Atoi(number)
+	if err != nil || i < 0 || i >= len(entries) {
+		return 0, false
+	}
+	return i, true
+}
+
+// removeFromPlaylist removes the entry with index 'number' from a saved playlist
+// Returns the name of the removed song or error if there is no such playlist or entry
+func (player *musicPlayer) removeFromPlaylist(name string, number string) (string, error) {
+	items, err := player.editPlaylist(name, func(path string, entries []playlistEntry) ([]playlistEntry, []string, error) {
+		index, ok := parsePlaylistIndex(number, entries)
+		if !ok {
+			return nil, nil, errors.New(playlist_entry_not_found_msg)
+		}
+		removed := entryPath(path, entries[index].Path)
+		return append(entries[:index], entries[index+1:]...), []string{removed}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return items[0], nil
+}
+
+// moveInPlaylist moves an entry of a saved playlist from one index to another
+// Returns the name of the moved song or error if there is no such playlist or entry
+func (player *musicPlayer) moveInPlaylist(name string, from string, to string) (string, error) {
+	items, err := player.editPlaylist(name, func(path string, entries []playlistEntry) ([]playlistEntry, []string, error) {
+		fromIndex, fromOk := parsePlaylistIndex(from, entries)
+		toIndex, toOk := parsePlaylistIndex(to, entries)
+		if !fromOk || !toOk {
+			return nil, nil, errors.New(playlist_entry_not_found_msg)
+		}
+		moved := entries[fromIndex]
+		entries = append(entries[:fromIndex], entries[fromIndex+1:]...)
+		entries = append(entries[:toIndex], append([]playlistEntry{moved}, entries[toIndex:]...)...)
+		return entries, []string{entryPath(path, moved.Path)}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return items[0], nil
+}
@@ -0,0 +1,168 @@
+package player
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// initPlaylistsPlayer creates a player with a temporary playlists directory with a playlist in it
+func initPlaylistsPlayer(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "music_player_playlists")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	initTestPlayer(t)
+	player.playlistsDir = dir + "/"
+	content := "#EXTM3U\n" +
+		"#EXTINF:2,Tester - Beep\n" +
+		"test_sounds/beep9.mp3\n" +
+		"test_sounds/beep28.mp3\n" +
+		"test_sounds/gone.mp3\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "list.m3u"), []byte(content), 0666)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return dir
+}
+
+func TestGetPlaylist(t *testing.T) {
+	fmt.Println("TestGetPlaylist")
+	dir := initPlaylistsPlayer(t)
+	defer os.RemoveAll(dir)
+
+	names, infos, err := player.getPlaylist("list.m3u")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "[test_sounds/beep9.mp3 test_sounds/beep28.mp3 test_sounds/gone.mp3]", fmt.Sprint(names))
+	checkStr(t, fmt.Sprint([]PlaylistEntryInfo{
+		{Name: "beep9.mp3", Title: "Tester - Beep", Duration: 2},
+		{Name: "beep28.mp3"},
+		{Name: "gone.mp3", Missing: true},
+	}), fmt.Sprint(infos))
+
+	for _, name := range []string{"missing.m3u", "../list.m3u", "list", ""} {
+		_, _, err = player.getPlaylist(name)
+		if err == nil {
+			t.Fatalf("Expected error for %q", name)
+		}
+		checkStr(t, playlist_not_found_msg, err.Error())
+	}
+}
+
+func TestEditPlaylist(t *testing.T) {
+	fmt.Println("TestEditPlaylist")
+	dir := initPlaylistsPlayer(t)
+	defer os.RemoveAll(dir)
+
+	items, err := player.addToPlaylist("list.m3u", "test_sounds/beep36.mp3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "[test_sounds/beep36.mp3]", fmt.Sprint(items))
+	// the queue is not changed
+	checkInt(t, 0, len(player.state.queue))
+
+	item, err := player.moveInPlaylist("list.m3u", "3", "0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "test_sounds/beep36.mp3", item)
+	item, err = player.removeFromPlaylist("list.m3u", "3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "test_sounds/gone.mp3", item)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "list.m3u"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the titles and durations are kept
+	checkStr(t, "#EXTM3U\ntest_sounds/beep36.mp3\n#EXTINF:2,Tester - Beep\ntest_sounds/beep9.mp3\n"+
+		"test_sounds/beep28.mp3\n", string(content))
+
+	_, err = player.removeFromPlaylist("list.m3u", "3")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, playlist_entry_not_found_msg, err.Error())
+	_, err = player.moveInPlaylist("list.m3u", "0", "-1")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, playlist_entry_not_found_msg, err.Error())
+	_, err = player.addToPlaylist("list.m3u", "test_broken/abc.txt")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	_, err = player.addToPlaylist("missing.m3u", "test_sounds/beep36.mp3")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, playlist_not_found_msg, err.Error())
+}
+
+func TestRenamePlaylist(t *testing.T) {
+	fmt.Println("TestRenamePlaylist")
+	dir := initPlaylistsPlayer(t)
+	defer os.RemoveAll(dir)
+
+	name, err := player.renamePlaylist("list.m3u", "renamed")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "renamed.m3u", name)
+
+	// the playlist is converted to the type of the new name
+	name, err = player.renamePlaylist("renamed.m3u", "converted.xspf")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "converted.xspf", name)
+	playlists, err := player.listPlaylists()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "[converted.xspf]", fmt.Sprint(playlists))
+	names, infos, err := player.getPlaylist("converted.xspf")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkInt(t, 3, len(names))
+	checkStr(t, "Tester - Beep", infos[0].Title)
+
+	ioutil.WriteFile(filepath.Join(dir, "other.pls"), []byte("[playlist]\n"), 0666)
+	_, err = player.renamePlaylist("converted.xspf", "other.pls")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, playlist_exists_msg, err.Error())
+	for _, newName := range []string{"../outside", "a/b", ""} {
+		_, err = player.renamePlaylist("converted.xspf", newName)
+		if err == nil {
+			t.Fatalf("Expected error for %q", newName)
+		}
+		checkStr(t, cannot_rename_playlist_msg, err.Error())
+	}
+}
+
+func TestDeletePlaylist(t *testing.T) {
+	fmt.Println("TestDeletePlaylist")
+	dir := initPlaylistsPlayer(t)
+	defer os.RemoveAll(dir)
+
+	name, err := player.deletePlaylist("list.m3u")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "list.m3u", name)
+	_, err = player.deletePlaylist("list.m3u")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, playlist_not_found_msg, err.Error())
+}
@@ -0,0 +1,256 @@
+package player
+
+import (
+	"errors"
+	"strconv"
+)
+
+// parseQueueIndex converts the index of a song in the queue
+// Returns false if there is no such song
+func (player *musicPlayer) parseQueueIndex(number string) (int, bool) {
+	// Warning: never call this if the player is not locked
+	i, err := strconv.Atoi(number)
+	if err != nil || i < 0 || i >= len(player.state.queue) {
+		return 0, false
+	}
+	return i, true
+}
+
+// moveInQueue moves a song in the queue from one index to another
+// The current song and the shuffled order keep pointing at the same songs
+func (player *musicPlayer) moveInQueue(from int, to int) {
+	// Warning: never call this if the player is not locked
+	if from == to {
+		return
+	}
+	// newIndex is where a song ends up after the move
+	newIndex := func(i int) int {
+		switch {
+		case i == from:
+			return to
+		case from < to && i > from && i <= to:
+			return i - 1
+		case to < from && i >= to && i < from:
+			return i + 1
+		}
+		return i
+	}
+
+	song := player.state.queue[from]
+	if from < to {
+		copy(player.state.queue[from:to], player.state.queue[from+1:to+1])
+	} else {
+		copy(player.state.queue[to+1:from+1], player.state.queue[to:from])
+	}
+	player.state.queue[to] = song
+
+	player.state.current = newIndex(player.state.current)
+	for i, index := range player.state.order {
+		player.state.order[i] = newIndex(index)
+	}
+}
+
+// removeFromQueue removes a song from the queue
+// The current song and the shuffled order keep pointing at the same songs
+// Warning: the caller decides what the current song is if it is the removed one
+func (player *musicPlayer) removeFromQueue(index int) {
+	// Warning: never call this if the player is not locked
+	player.state.queue = append(player.state.queue[:index], player.state.queue[index+1:]...)
+	if player.state.current > index {
+		player.state.current -= 1
+	}
+	order := make([]int, 0, len(player.state.order))
+	for _, el := range player.state.order {
+		if el > index {
+			order = append(order, el-1)
+		} else if el < index {
+			order = append(order, el)
+		}
+	}
+	if player.state.order != nil {
+		player.state.order = order
+	}
+}
+
+// moveToOrderAfterCurrent moves songs right after the current one in the shuffled order
+func (player *musicPlayer) moveToOrderAfterCurrent(indexes []int) {
+	// Warning: never call this if the player is not locked
+	if !player.state.shuffle {
+		return
+	}
+	moved := make(map[int]bool)
+	for _, index := range indexes {
+		moved[index] = true
+	}
+	order := make([]int, 0, len(player.state.order))
+	for _, el := range player.state.order {
+		if !moved[el] {
+			order = append(order, el)
+		}
+		if el == player.state.current {
+			order = append(order, indexes...)
+		}
+	}
+	player.state.order = order
+}
+
+// removeSong removes the song with index 'number' from the queue
+// If the song is the current one, the player goes on with the following song like next does
+// Returns the name of the removed song or error if there is no such song
+func (player *musicPlayer) removeSong(number string) (string, error) {
+	player.Lock()
+	index, ok := player.parseQueueIndex(number)
+	if !ok {
+		player.Unlock()
+		return "", errors.New(cannot_remove_song_msg)
+	}
+	removed := player.state.queue[index]
+
+	if index != player.state.current || player.state.status == waiting {
+		player.removeFromQueue(index)
+		if player.state.current >= len(player.state.queue) {
+			player.state.current = 0
+		}
+		player.stateChanged()
+		player.Unlock()
+		return removed, nil
+	}
+
+	following, hasFollowing := player.followingIndex(true)
+	if hasFollowing && following == index {
+		// the removed song was the only one in repeat all
+		hasFollowing = false
+	}
+	wasPlaying := player.state.status == playing
+	if wasPlaying {
+		player.stopFlow()
+	}
+	player.state.durationPaused = 0
+	// removeFromQueue shifts the following song if needed
+	player.state.current = following
+	player.removeFromQueue(index)
+	player.resetSignal()
+	player.stateChanged()
+
+	if !hasFollowing {
+		player.Unlock()
+		// wait for the removed song to stop before there is nothing to play
+		player.waitEnd()
+		player.Lock()
+		player.state.current = player.firstIndex()
+		player.state.status = waiting
+		player.publish(Event{Type: eventStopped})
+		player.stateChanged()
+		player.Unlock()
+		return removed, nil
+	}
+
+	player.Unlock()
+	if wasPlaying {
+		return removed, player.playFrom(0)
+	}
+	return removed, nil
+}
+
+// moveSong moves a song in the queue from index 'from' to index 'to'
+// The current song keeps playing
+// Returns the name of the moved song or error if there is no such song
+func (player *musicPlayer) moveSong(from string, to string) (string, error) {
+	player.Lock()
+	defer player.Unlock()
+	fromIndex, ok := player.parseQueueIndex(from)
+	if !ok {
+		return "", errors.New(cannot_move_song_msg)
+	}
+	toIndex, ok := player.parseQueueIndex(to)
+	if !ok {
+		return "", errors.New(cannot_move_song_msg)
+	}
+	song := player.state.queue[fromIndex]
+	player.moveInQueue(fromIndex, toIndex)
+	player.stateChanged()
+	return song, nil
+}
+
+// playNext adds a file, directory or playlist to the queue right after the current song
+// Starts playing if player is in waiting state
+// Returns added songs or error if nothing was added
+func (player *musicPlayer) playNext(playItem string) ([]string, error) {
+	player.Lock()
+	first := len(player.state.queue)
+	items, err := player.addPlayItem(playItem)
+	if err != nil {
+		player.Unlock()
+		return items, err
+	}
+
+	// nothing is playing - the songs are played right away
+	isWaiting := player.state.status == waiting
+	position := player.state.current + 1
+	if isWaiting || first == 0 {
+		position = player.state.current
+	}
+	if position > first {
+		position = first
+	}
+	added := make([]int, 0, len(items))
+	for i := first; i < len(player.state.queue); i++ {
+		player.moveInQueue(i, position)
+		added = append(added, position)
+		position += 1
+	}
+	if isWaiting {
+		// the queue starts over with the first added song
+		player.state.current = added[0]
+		added = added[1:]
+		if player.state.shuffle {
+			player.moveInOrderToFront(player.state.current)
+		}
+	}
+	player.moveToOrderAfterCurrent(added)
+	player.stateChanged()
+	player.Unlock()
+	player.readQueueTags()
+
+	if isWaiting {
+		return items, player.playFrom(0)
+	}
+	return items, nil
+}
+
+// moveInOrderToFront makes a song the first one in the shuffled order
+func (player *musicPlayer) moveInOrderToFront(index int) {
+	// Warning: never call this if the player is not locked
+	order := []int{index}
+	for _, el := range player.state.order {
+		if el != index {
+			order = append(order, el)
+		}
+	}
+	player.state.order = order
+}
+
+// clearQueue removes all songs from the queue without stopping the playback
+// The current song stays in the queue while it is playing or paused
+// Returns the name of the song that is kept
+func (player *musicPlayer) clearQueue() []string {
+	player.Lock()
+	defer player.Unlock()
+	kept := make([]string, 0)
+	hasCurrent := player.state.current < len(player.state.queue)
+	if hasCurrent && (player.state.status == playing || player.state.status == paused) {
+		kept = append(kept, player.state.queue[player.state.current])
+	}
+	player.state.queue = append(make([]string, 0), kept...)
+	player.state.current = 0
+	player.state.order = nil
+	player.releasePrepared()
+	if player.state.shuffle {
+		player.shuffleOrder(true)
+	}
+	if len(kept) == 0 {
+		player.resetSignal()
+	}
+	player.stateChanged()
+	return kept
+}
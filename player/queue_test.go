@@ -0,0 +1,121 @@
+package player
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// initQueuePlayer creates a player with four songs in the queue
+func initQueuePlayer(t *testing.T) {
+	initTestPlayer(t)
+	player.state.queue = []string{"a.mp3", "b.mp3", "c.mp3", "d.mp3"}
+}
+
+func checkQueue(t *testing.T, expected []string) {
+	if !reflect.DeepEqual(expected, player.state.queue) {
+		t.Errorf("Expected\n---\n%v\n---\nbut found\n---\n%v\n---\n", expected, player.state.queue)
+	}
+}
+
+func TestMoveInQueueForward(t *testing.T) {
+	fmt.Println("TestMoveInQueueForward")
+	initQueuePlayer(t)
+	player.state.current = 2
+	player.moveInQueue(0, 3)
+	checkQueue(t, []string{"b.mp3", "c.mp3", "d.mp3", "a.mp3"})
+	checkInt(t, 1, player.state.current)
+}
+
+func TestMoveInQueueBackward(t *testing.T) {
+	fmt.Println("TestMoveInQueueBackward")
+	initQueuePlayer(t)
+	player.state.current = 3
+	player.state.shuffle = true
+	player.state.order = []int{3, 1, 0, 2}
+	player.moveInQueue(3, 0)
+	checkQueue(t, []string{"d.mp3", "a.mp3", "b.mp3", "c.mp3"})
+	checkInt(t, 0, player.state.current)
+	if !reflect.DeepEqual([]int{0, 2, 1, 3}, player.state.order) {
+		t.Errorf("Expected the order to follow the songs, but found %v", player.state.order)
+	}
+}
+
+func TestRemoveFromQueueBeforeCurrent(t *testing.T) {
+	fmt.Println("TestRemoveFromQueueBeforeCurrent")
+	initQueuePlayer(t)
+	player.state.current = 2
+	player.state.shuffle = true
+	player.state.order = []int{2, 0, 3, 1}
+	player.removeFromQueue(1)
+	checkQueue(t, []string{"a.mp3", "c.mp3", "d.mp3"})
+	checkInt(t, 1, player.state.current)
+	if !reflect.DeepEqual([]int{1, 0, 2}, player.state.order) {
+		t.Errorf("Expected the order to follow the songs, but found %v", player.state.order)
+	}
+}
+
+func TestRemoveSongWaiting(t *testing.T) {
+	fmt.Println("TestRemoveSongWaiting")
+	initQueuePlayer(t)
+	player.state.current = 3
+	removed, err := player.removeSong("3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "d.mp3", removed)
+	checkInt(t, 0, player.state.current)
+
+	_, err = player.removeSong("3")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, cannot_remove_song_msg, err.Error())
+}
+
+func TestRemoveCurrentSongPaused(t *testing.T) {
+	fmt.Println("TestRemoveCurrentSongPaused")
+	initQueuePlayer(t)
+	player.state.current = 1
+	player.state.status = paused
+	player.removeSong("1")
+	checkQueue(t, []string{"a.mp3", "c.mp3", "d.mp3"})
+	checkInt(t, 1, player.state.current)
+	checkInt(t, paused, player.state.status)
+
+	player.state.current = 2
+	player.removeSong("2")
+	checkInt(t, 0, player.state.current)
+	checkInt(t, waiting, player.state.status)
+}
+
+func TestMoveToOrderAfterCurrent(t *testing.T) {
+	fmt.Println("TestMoveToOrderAfterCurrent")
+	initQueuePlayer(t)
+	player.state.current = 1
+	player.state.shuffle = true
+	player.state.order = []int{3, 1, 0, 2}
+	player.moveToOrderAfterCurrent([]int{2})
+	if !reflect.DeepEqual([]int{3, 1, 2, 0}, player.state.order) {
+		t.Errorf("Expected\n---\n[3 1 2 0]\n---\nbut found\n---\n%v\n---\n", player.state.order)
+	}
+}
+
+func TestClearQueueWaiting(t *testing.T) {
+	fmt.Println("TestClearQueueWaiting")
+	initQueuePlayer(t)
+	kept := player.clearQueue()
+	checkInt(t, 0, len(kept))
+	checkInt(t, 0, len(player.state.queue))
+}
+
+func TestClearQueuePaused(t *testing.T) {
+	fmt.Println("TestClearQueuePaused")
+	initQueuePlayer(t)
+	player.state.current = 2
+	player.state.status = paused
+	kept := player.clearQueue()
+	checkQueue(t, []string{"c.mp3"})
+	checkQueue(t, kept)
+	checkInt(t, 0, player.state.current)
+}
@@ -0,0 +1,107 @@
+package player
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// setMusicRoots sets the directories music can be played from
+// No roots means music can be played from anywhere
+// Returns error if a root cannot be resolved
+func (player *musicPlayer) setMusicRoots(roots []string) error {
+	resolved := make([]string, 0, len(roots))
+	for _, root := range roots {
+		realRoot, err := realPath(root)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, realRoot)
+	}
+	player.Lock()
+	defer player.Unlock()
+	player.musicRoots = resolved
+	return nil
+}
+
+// realPath returns the absolute path with all symlinks resolved
+func realPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absPath)
+}
+
+// isInside checks if path is the directory dir or inside it
+func isInside(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isInMusicRoots checks if an existing file or directory is inside one of the music roots
+// Symlinks are followed so that a link cannot point outside the roots
+func (player *musicPlayer) isInMusicRoots(path string) bool {
+	// Warning: never call this if the player is not locked
+	if len(player.musicRoots) == 0 {
+		return true
+	}
+	realFile, err := realPath(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range player.musicRoots {
+		if isInside(root, realFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveMusicPath finds the file or directory a request is about
+// Relative paths are looked up in the music roots first and then in the working directory
+// Returns the path to be played (unchanged if it does not exist, so it can be tried as a playlist)
+// or error if it exists outside the music roots
+func (player *musicPlayer) resolveMusicPath(path string) (string, error) {
+	// Warning: never call this if the player is not locked
+	if len(player.musicRoots) == 0 {
+		return path, nil
+	}
+	candidates := make([]string, 0, len(player.musicRoots)+1)
+	if !filepath.IsAbs(path) {
+		for _, root := range player.musicRoots {
+			candidates = append(candidates, filepath.Join(root, path))
+		}
+	}
+	candidates = append(candidates, path)
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		if !player.isInMusicRoots(candidate) {
+			return path, errors.New(outside_music_roots_msg)
+		}
+		return candidate, nil
+	}
+	return path, nil
+}
+
+// playlistPath returns the path of a saved playlist
+// Returns false if the name points outside the playlists directory
+func (player *musicPlayer) playlistPath(name string) (string, bool) {
+	path := player.playlistsDir + name
+	dir, err := filepath.Abs(player.playlistsDir)
+	if err != nil {
+		return path, false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil || !isInside(dir, absPath) || absPath == dir {
+		return path, false
+	}
+	return path, true
+}
@@ -0,0 +1,83 @@
+package player
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddPlayItemInRoot(t *testing.T) {
+	fmt.Println("TestAddPlayItemInRoot")
+	initTestPlayer(t, "test_sounds")
+	items, err := player.addPlayItem("beep9.mp3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkIntFatal(t, 1, len(items))
+	expected, _ := filepath.Abs("test_sounds/beep9.mp3")
+	checkStr(t, expected, items[0])
+
+	items, err = player.addPlayItem("test_sounds/beep28.mp3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "test_sounds/beep28.mp3", items[0])
+}
+
+func TestAddPlayItemOutsideRoot(t *testing.T) {
+	fmt.Println("TestAddPlayItemOutsideRoot")
+	initTestPlayer(t, "test_sounds")
+	for _, item := range []string{"test_broken/no_music.mp3", "../test_broken/no_music.mp3", "test_broken"} {
+		_, err := player.addPlayItem(item)
+		if err == nil {
+			t.Errorf("Expected error for %s", item)
+			continue
+		}
+		checkStr(t, outside_music_roots_msg, err.Error())
+	}
+	checkInt(t, 0, len(player.state.queue))
+}
+
+func TestAddPlayItemSymlinkOutsideRoot(t *testing.T) {
+	fmt.Println("TestAddPlayItemSymlinkOutsideRoot")
+	root, err := ioutil.TempDir("", "music_root")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(root)
+	target, _ := filepath.Abs("test_sounds/beep9.mp3")
+	os.Symlink(target, filepath.Join(root, "link.mp3"))
+
+	initTestPlayer(t, root)
+	_, err = player.addPlayItem("link.mp3")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkStr(t, outside_music_roots_msg, err.Error())
+}
+
+func TestAddPlaylistOutsideRoot(t *testing.T) {
+	fmt.Println("TestAddPlaylistOutsideRoot")
+	initTestPlayer(t, "test_broken")
+	// the playlist is allowed, but its songs are not
+	_, err := player.addPlayItem("sample_playlist.m3u")
+	if err == nil {
+		t.Fatalf("Error expected")
+	}
+	checkInt(t, 0, len(player.state.queue))
+}
+
+func TestPlaylistPathTraversal(t *testing.T) {
+	fmt.Println("TestPlaylistPathTraversal")
+	initTestPlayer(t)
+	_, ok := player.playlistPath("sample_playlist.m3u")
+	if !ok {
+		t.Errorf("Expected sample_playlist.m3u to be a playlist")
+	}
+	_, ok = player.playlistPath("../test_sounds/beep9.mp3")
+	if ok {
+		t.Errorf("Expected ../test_sounds/beep9.mp3 NOT to be a playlist")
+	}
+}
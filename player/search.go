@@ -0,0 +1,244 @@
+package player
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// trackIdPrefix starts the ids of the library tracks so that they are not mistaken for file names
+const trackIdPrefix = "track:"
+
+// searchLimit is how many results a search returns if no limit is given
+const searchLimit = 100
+
+// searchFields are the fields a search can be filtered by e.g. artist:"daft punk" year:2001
+var searchFields = []string{"artist", "album", "genre", "year"}
+
+// TrackInfo describes a track of the library in the responses
+// The path is not exposed, the id is used to play or add the track
+type TrackInfo struct {
+	Id   string
+	Name string
+	Tags
+	Duration float64 `json:"Duration,omitempty"`
+}
+
+// trackId creates the id of a track from its path, so that it stays the same across scans and restarts
+func trackId(path string) string {
+	hash := sha1.Sum([]byte(path))
+	return trackIdPrefix + hex.EncodeToString(hash[:8])
+}
+
+// info describes the track for the responses
+func (track Track) info() TrackInfo {
+	return TrackInfo{Id: trackId(track.Path), Name: filepath.Base(track.Path), Tags: track.Tags,
+		Duration: track.Duration}
+}
+
+// trackPath finds the path of a track by its id
+// Returns false if the library has no such track
+func (library *library) trackPath(id string) (string, bool) {
+	if !strings.HasPrefix(id, trackIdPrefix) {
+		return "", false
+	}
+	library.Lock()
+	defer library.Unlock()
+	path, ok := library.ids[id]
+	return path, ok
+}
+
+// searchFilter restricts a search to the tracks whose field contains the value
+type searchFilter struct {
+	field string
+	value string
+}
+
+// searchQuery is a parsed search - free text terms and field filters, all lowercase
+type searchQuery struct {
+	terms   []string
+	filters []searchFilter
+}
+
+// parseSearchQuery splits a query into terms and field filters
+// Double quotes keep words together e.g. artist:"daft punk" "one more time"
+func parseSearchQuery(query string) searchQuery {
+	parsed := searchQuery{}
+	for _, token := range splitQuery(strings.ToLower(query)) {
+		i := strings.Index(token, ":")
+		if i > 0 && contains(searchFields, token[:i]) {
+			if value := strings.TrimSpace(token[i+1:]); len(value) > 0 {
+				parsed.filters = append(parsed.filters, searchFilter{field: token[:i], value: value})
+			}
+			continue
+		}
+		parsed.terms = append(parsed.terms, token)
+	}
+	return parsed
+}
+
+// splitQuery splits a query at the spaces that are not in double quotes. The quotes are removed
+func splitQuery(query string) []string {
+	tokens := make([]string, 0)
+	current := make([]rune, 0)
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if len(current) > 0 {
+				tokens = append(tokens, string(current))
+				current = current[:0]
+			}
+		default:
+			current = append(current, r)
+		}
+	}
+	if len(current) > 0 {
+		tokens = append(tokens, string(current))
+	}
+	return tokens
+}
+
+// matchScore rates how well value matches a lowercase term - 3 if equal,
+// 2 if a word of value starts with it, 1 if value contains it and 0 if it does not match
+func matchScore(value string, term string) int {
+	value = strings.ToLower(value)
+	switch {
+	case len(value) == 0:
+		return 0
+	case value == term:
+		return 3
+	case strings.HasPrefix(value, term):
+		return 2
+	case strings.Contains(value, " "+term):
+		return 2
+	case strings.Contains(value, term):
+		return 1
+	}
+	return 0
+}
+
+// fieldValue returns the value of a search field of the track
+func (track Track) fieldValue(field string) string {
+	switch field {
+	case "artist":
+		return track.Artist
+	case "album":
+		return track.Album
+	case "genre":
+		return track.Genre
+	case "year":
+		return track.Year
+	}
+	return ""
+}
+
+// score rates how well the track matches the query. Titles weigh more than artists,
+// artists more than albums and so on
+// Returns 0 if a filter or a term does not match
+func (track Track) score(query searchQuery) int {
+	total := 0
+	for _, filter := range query.filters {
+		score := matchScore(track.fieldValue(filter.field), filter.value)
+		if score == 0 {
+			return 0
+		}
+		total += score
+	}
+	fields := []struct {
+		value  string
+		weight int
+	}{
+		{track.Title, 4},
+		{track.Artist, 3},
+		{track.Album, 2},
+		{track.Genre, 1},
+		{filepath.Base(track.Path), 1},
+	}
+	for _, term := range query.terms {
+		best := 0
+		for _, field := range fields {
+			if score := matchScore(field.value, term) * field.weight; score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total
+}
+
+// lessTrack orders the tracks with equal scores by artist, album, track number, title and path
+func lessTrack(a Track, b Track) bool {
+	if artistA, artistB := strings.ToLower(a.Artist), strings.ToLower(b.Artist); artistA != artistB {
+		return artistA < artistB
+	}
+	if albumA, albumB := strings.ToLower(a.Album), strings.ToLower(b.Album); albumA != albumB {
+		return albumA < albumB
+	}
+	if a.Track != b.Track {
+		return a.Track < b.Track
+	}
+	if titleA, titleB := strings.ToLower(a.Title), strings.ToLower(b.Title); titleA != titleB {
+		return titleA < titleB
+	}
+	return a.Path < b.Path
+}
+
+// search finds the library tracks matching the query, the best matches first
+// limit is the maximum number of results as a string - empty for searchLimit
+// Returns the file names and the tracks found
+// or error if the query is empty or the limit is not a positive number
+func (player *musicPlayer) search(query string, limit string) ([]string, []TrackInfo, error) {
+	parsed := parseSearchQuery(query)
+	if len(parsed.terms) == 0 && len(parsed.filters) == 0 {
+		return nil, nil, errors.New(empty_search_msg)
+	}
+	maxResults := searchLimit
+	if len(limit) > 0 {
+		var err error
+		maxResults, err = strconv.Atoi(limit)
+		if err != nil || maxResults <= 0 {
+			return nil, nil, errors.New(invalid_search_limit_msg)
+		}
+	}
+
+	player.library.Lock()
+	type result struct {
+		track Track
+		score int
+	}
+	results := make([]result, 0)
+	for _, track := range player.library.tracks {
+		if score := track.score(parsed); score > 0 {
+			results = append(results, result{track, score})
+		}
+	}
+	player.library.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return lessTrack(results[i].track, results[j].track)
+	})
+	if len(results) > maxResults {
+		results = results[:maxResults]
+	}
+	names := make([]string, 0, len(results))
+	tracks := make([]TrackInfo, 0, len(results))
+	for _, found := range results {
+		names = append(names, found.track.Path)
+		tracks = append(tracks, found.track.info())
+	}
+	return names, tracks, nil
+}
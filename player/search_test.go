@@ -0,0 +1,112 @@
+package player
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// initSearchPlayer creates a player with a library of tracks that are not read from files
+func initSearchPlayer(t *testing.T, tracks ...Track) {
+	initTestPlayer(t)
+	library := make(map[string]Track)
+	for _, track := range tracks {
+		library[track.Path] = track
+	}
+	player.library.setTracks(library)
+}
+
+func searchNames(t *testing.T, query string, limit string) []string {
+	names, tracks, err := player.search(query, limit)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkIntFatal(t, len(names), len(tracks))
+	return filterPath(names)
+}
+
+func checkNames(t *testing.T, expected []string, found []string) {
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("Expected %v but found %v", expected, found)
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	fmt.Println("TestParseSearchQuery")
+	parsed := parseSearchQuery(`Beep artist:"The Testers" year:2017 genre: "one more" title:x`)
+	checkNames(t, []string{"beep", "one more", "title:x"}, parsed.terms)
+	expected := []searchFilter{{"artist", "the testers"}, {"year", "2017"}}
+	if !reflect.DeepEqual(expected, parsed.filters) {
+		t.Errorf("Expected %v but found %v", expected, parsed.filters)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	fmt.Println("TestSearch")
+	initSearchPlayer(t,
+		Track{Path: "/music/a/beep.mp3", Tags: Tags{Title: "Beep", Artist: "Tester", Album: "Noises", Year: "2017"}},
+		Track{Path: "/music/a/long_beep.mp3", Tags: Tags{Title: "Long Beep", Artist: "Tester", Album: "Noises",
+			Year: "2017", Track: 2}},
+		Track{Path: "/music/b/song.mp3", Tags: Tags{Title: "Song", Artist: "Beep Band", Genre: "Rock", Year: "2001"}},
+		Track{Path: "/music/c/beep_demo.mp3"})
+
+	// equal titles first, then the words starting with the term, then the rest
+	checkNames(t, []string{"beep.mp3", "long_beep.mp3", "song.mp3", "beep_demo.mp3"}, searchNames(t, "beep", ""))
+	checkNames(t, []string{"beep.mp3"}, searchNames(t, "beep", "1"))
+	checkNames(t, []string{"beep.mp3", "long_beep.mp3"}, searchNames(t, "BEEP artist:tester", ""))
+	checkNames(t, []string{"song.mp3"}, searchNames(t, "year:2001", ""))
+	checkNames(t, []string{"song.mp3"}, searchNames(t, `artist:"beep band" genre:rock`, ""))
+	checkNames(t, []string{}, searchNames(t, "beep genre:jazz", ""))
+
+	_, _, err := player.search(" artist: ", "")
+	if err == nil {
+		t.Errorf("Error expected")
+	} else {
+		checkStr(t, empty_search_msg, err.Error())
+	}
+	_, _, err = player.search("beep", "none")
+	if err == nil {
+		t.Errorf("Error expected")
+	} else {
+		checkStr(t, invalid_search_limit_msg, err.Error())
+	}
+}
+
+func TestSearchTrackIds(t *testing.T) {
+	fmt.Println("TestSearchTrackIds")
+	path, err := filepath.Abs("test_sounds/beep9.mp3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	initSearchPlayer(t, readTrack(path, info))
+
+	_, tracks, err := player.search("beep9", "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkIntFatal(t, 1, len(tracks))
+	checkStr(t, trackId(path), tracks[0].Id)
+	checkStr(t, "beep9.mp3", tracks[0].Name)
+
+	// the id plays the track
+	player.Lock()
+	items, err := player.addPlayItem(tracks[0].Id)
+	player.Unlock()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkNames(t, []string{path}, items)
+
+	player.Lock()
+	_, err = player.addPlayItem(trackIdPrefix + "0000000000000000")
+	player.Unlock()
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
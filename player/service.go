@@ -35,6 +35,35 @@ const cannot_save_playlist_msg = "Cannot save playlist"
 const cannot_save_empty_queue_msg = "Queue is empty and cannot be saved as playlist"
 const cannot_get_queue_info_msg = "Cannot get queue info. Queue is empty"
 const cannot_jump_to_song_msg = "Song not available"
+const unknown_output_msg = "Unknown output"
+const cannot_seek_msg = "Cannot seek. No song is playing or paused"
+const invalid_seek_position_msg = "Invalid seek position"
+const invalid_volume_msg = "Invalid volume. Use 0-100 percent or dB up to 0"
+const invalid_repeat_mode_msg = "Invalid repeat mode. Use off, one or all"
+const invalid_shuffle_mode_msg = "Invalid shuffle mode. Use on or off"
+const invalid_crossfade_msg = "Invalid crossfade. Use 0-30 seconds"
+const cannot_remove_song_msg = "Cannot remove. Song not available"
+const cannot_move_song_msg = "Cannot move. Song not available"
+const no_tags_msg = "No tags found"
+const outside_music_roots_msg = "File is outside the music library"
+const invalid_role_msg = "Invalid role. Use readonly, controller or admin"
+const unauthorized_msg = "Missing or invalid token"
+const forbidden_msg = "Not allowed with this token"
+const unknown_action_msg = "Unknown action"
+const invalid_arguments_msg = "Invalid arguments for the action"
+const invalid_command_msg = "Invalid command. Send json with Action and Args"
+const no_music_roots_msg = "No music roots to scan"
+const library_scanning_msg = "Library is already being scanned"
+const empty_search_msg = "Search query is empty"
+const invalid_search_limit_msg = "Invalid search limit"
+const no_artists_msg = "There are no artists in the library"
+const artist_not_found_msg = "Artist cannot be found"
+const album_not_found_msg = "Album cannot be found"
+const no_genres_msg = "There are no genres in the library"
+const cannot_delete_playlist_msg = "Cannot delete playlist"
+const cannot_rename_playlist_msg = "Cannot rename playlist"
+const playlist_exists_msg = "Playlist already exists"
+const playlist_entry_not_found_msg = "Playlist entry not available"
 
 const started_playing_info = "Started playing"
 const added_to_queue_info = "Added to queue"
@@ -46,10 +75,34 @@ const current_queue_info = "The filenames in the current queue"
 const queue_saved_as_playlist = "The queue is saved as a playlist"
 const playlists_info = "A list of all saved playlists"
 const queue_info = "Queue content"
+const seek_song_info = "Song position is changed"
+const volume_info = "Volume of the player"
+const volume_changed_info = "Volume is changed"
+const muted_info = "Player is muted"
+const unmuted_info = "Player is unmuted"
+const modes_info = "Repeat and shuffle modes"
+const modes_changed_info = "Mode is changed"
+const removed_from_queue_info = "Removed from queue"
+const moved_in_queue_info = "Moved in queue"
+const added_to_play_next_info = "Added to be played next"
+const queue_cleared_info = "Queue is cleared"
+const library_rescan_info = "Library rescan is started"
+const library_stats_info = "Library statistics"
+const search_info = "Search results"
+const artists_info = "Artists in the library"
+const albums_info = "Albums of the artist"
+const album_tracks_info = "Tracks of the album"
+const genres_info = "Genres in the library"
+const playlist_info = "Playlist content"
+const playlist_deleted_info = "Playlist is deleted"
+const playlist_renamed_info = "Playlist is renamed"
+const added_to_playlist_info = "Added to playlist"
+const removed_from_playlist_info = "Removed from playlist"
+const moved_in_playlist_info = "Moved in playlist"
 
 // ResponseContainer defines the format of the web service's response
-// It contains code - 0 for success and 1 for error, message that explains actions is performed
-// and data which is a list of file names
+// It contains code - 0 for success and 1 for error, message that explains actions is performed,
+// data which is a list of file names and optional structured info (e.g. SongInfo)
 type ResponseContainer struct {
 	// 0 for success, 1 for failure
 	Code int
@@ -57,17 +110,43 @@ type ResponseContainer struct {
 	Message string
 	// Filename (list if filenames)
 	Data []string `json:"Data,omitempty"`
+	// Structured info about the player
+	Info interface{} `json:"Info,omitempty"`
+}
+
+// SongInfo describes the current song and the progress of its playback
+type SongInfo struct {
+	// Filename of the song
+	Name string
+	// playing, paused or waiting
+	Status string
+	// Played seconds
+	Elapsed float64
+	// Total duration in seconds. 0 if not known yet
+	Duration float64
+	// Index of the song in the queue
+	Index int
+	// Sample rate and number of channels of the song. 0 if not known yet
+	SampleRate float64
+	Channels   uint
+	// Title, artist, album etc. Only when the song has tags
+	Tags *Tags `json:"Tags,omitempty"`
 }
 
 // writeHttpResponse writes response
 func writeHttpResponse(w http.ResponseWriter, container ResponseContainer) {
+	writeHttpResponseStatus(w, container, http.StatusOK)
+}
+
+// writeHttpResponseStatus writes response with the given HTTP status code
+func writeHttpResponseStatus(w http.ResponseWriter, container ResponseContainer, status int) {
 	message, err1 := json.Marshal(container)
 	if err1 != nil {
 		http.Error(w, err1.Error(), http.StatusInternalServerError)
 	} else {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 		if message != nil {
 			w.Write(message)
 		}
@@ -95,9 +174,16 @@ func alive(w http.ResponseWriter, r *http.Request) {
 
 // playerToServiceResponse constructs the response in the format of the service and writes it
 func playerToServiceResponse(w http.ResponseWriter, data []string, err error, successMessage string) {
+	playerInfoToServiceResponse(w, data, nil, err, successMessage)
+}
+
+// playerInfoToServiceResponse constructs the response with structured info and writes it
+func playerInfoToServiceResponse(w http.ResponseWriter, data []string, info interface{}, err error,
+	successMessage string) {
 	container := getResponseContainer(filterPath(data), err)
 	if err == nil {
 		container.Message = successMessage
+		container.Info = info
 	}
 	writeHttpResponse(w, container)
 }
@@ -162,12 +248,14 @@ func previous(w http.ResponseWriter, r *http.Request) {
 	playerToServiceResponse(w, []string{data}, err, started_playing_info)
 }
 
-// Gets the filename of the current song
-// The result json contains the filename of the running song
+// Gets the info about the current song
+// The result json contains the filename of the running song and its status, elapsed time, duration,
+// index in the queue, sample rate and channels
 // or error message if no song is playing at the moment
 func getCurrentSongInfo(w http.ResponseWriter, r *http.Request) {
-	data, err := player.getCurrentSongInfo()
-	playerToServiceResponse(w, []string{data}, err, current_song_info)
+	info, err := player.getCurrentSongInfo()
+	info.Name = filterPath([]string{info.Name})[0]
+	playerInfoToServiceResponse(w, []string{info.Name}, info, err, current_song_info)
 }
 
 // Add a song, directory or playlist to the play queue - songs will be played after all others in the queue
@@ -197,12 +285,71 @@ func listPlaylists(w http.ResponseWriter, r *http.Request) {
 	playerToServiceResponse(w, data, err, playlists_info)
 }
 
+// getPlaylist lists the songs of a saved playlist
+// The result json contains the filenames and the entries with their titles, durations and tags
+// or error message if there is no such playlist
+func getPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := pat.Param(ctx, "name")
+	data, info, err := player.getPlaylist(name)
+	playerInfoToServiceResponse(w, data, info, err, playlist_info)
+}
+
+// deletePlaylist deletes a saved playlist
+// The result json contains the name of the playlist
+// or error message if there is no such playlist
+func deletePlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := pat.Param(ctx, "name")
+	data, err := player.deletePlaylist(name)
+	playerToServiceResponse(w, []string{data}, err, playlist_deleted_info)
+}
+
+// renamePlaylist renames a saved playlist to the name in the "to" parameter
+// The result json contains the new name of the playlist
+// or error message if there is no such playlist or the new name is taken
+func renamePlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := pat.Param(ctx, "name")
+	data, err := player.renamePlaylist(name, r.URL.Query().Get("to"))
+	playerToServiceResponse(w, []string{data}, err, playlist_renamed_info)
+}
+
+// addToPlaylist appends a song, directory or playlist to a saved playlist without changing the queue
+// The result json contains the filenames of the added songs
+// or error message if there is no such playlist or nothing can be added
+func addToPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := pat.Param(ctx, "name")
+	item := pat.Param(ctx, "item")
+	data, err := player.addToPlaylist(name, item)
+	playerToServiceResponse(w, data, err, added_to_playlist_info)
+}
+
+// removeFromPlaylist removes the entry with the given index from a saved playlist
+// The result json contains the filename of the removed song
+// or error message if there is no such playlist or entry
+func removeFromPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := pat.Param(ctx, "name")
+	index := pat.Param(ctx, "index")
+	data, err := player.removeFromPlaylist(name, index)
+	playerToServiceResponse(w, []string{data}, err, removed_from_playlist_info)
+}
+
+// moveInPlaylist moves an entry within a saved playlist
+// The result json contains the filename of the moved song
+// or error message if there is no such playlist or entry
+func moveInPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := pat.Param(ctx, "name")
+	from := pat.Param(ctx, "from")
+	to := pat.Param(ctx, "to")
+	data, err := player.moveInPlaylist(name, from, to)
+	playerToServiceResponse(w, []string{data}, err, moved_in_playlist_info)
+}
+
 // getQueueInfo Displays all songs in the queue
-// The result json contains all filenames in the current queue
+// The result json contains all filenames in the current queue, the index of the current song,
+// repeat and shuffle modes and the shuffled order
 // or an error message if queue is empty
 func getQueueInfo(w http.ResponseWriter, r *http.Request) {
-	data, err := player.getQueueInfo()
-	playerToServiceResponse(w, data, err, queue_info)
+	data, info, err := player.getQueueDetails()
+	playerInfoToServiceResponse(w, data, info, err, queue_info)
 }
 
 var player musicPlayer
@@ -225,6 +372,178 @@ func jump(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	playerToServiceResponse(w, []string{data}, err, started_playing_info)
 }
 
+// Seeks to a position within the current song
+// The position is in seconds - absolute (42) or relative to the current position (+30 or -10)
+// The result json contains the filename of the current song
+// or error message if no song is playing or paused or the position is invalid
+func seek(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	position := pat.Param(ctx, "seconds")
+	data, err := player.seek(position)
+	playerToServiceResponse(w, []string{data}, err, seek_song_info)
+}
+
+// getVolume gets the volume of the player
+// The result json contains the volume in percent and dB and whether the player is muted
+func getVolume(w http.ResponseWriter, r *http.Request) {
+	info := player.getVolume()
+	playerInfoToServiceResponse(w, []string{}, info, nil, volume_info)
+}
+
+// setVolume sets the volume of the player in percent (50 or 50%) or dB (-6dB). Unmutes the player
+// The result json contains the new volume
+// or error message if the volume is invalid
+func setVolume(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	level := pat.Param(ctx, "level")
+	info, err := player.setVolume(level)
+	playerInfoToServiceResponse(w, []string{}, info, err, volume_changed_info)
+}
+
+// mute mutes the player. The volume is kept and restored on unmute
+// The result json contains the volume
+func mute(w http.ResponseWriter, r *http.Request) {
+	info, err := player.mute()
+	playerInfoToServiceResponse(w, []string{}, info, err, muted_info)
+}
+
+// unmute restores the volume of the player
+// The result json contains the volume
+func unmute(w http.ResponseWriter, r *http.Request) {
+	info, err := player.unmute()
+	playerInfoToServiceResponse(w, []string{}, info, err, unmuted_info)
+}
+
+// getModes gets the repeat and shuffle modes
+// The result json contains the modes
+func getModes(w http.ResponseWriter, r *http.Request) {
+	info := player.getModes()
+	playerInfoToServiceResponse(w, []string{}, info, nil, modes_info)
+}
+
+// setRepeat sets the repeat mode - off, one or all
+// The result json contains the modes
+// or error message if the mode is unknown
+func setRepeat(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	mode := pat.Param(ctx, "mode")
+	info, err := player.setRepeat(mode)
+	playerInfoToServiceResponse(w, []string{}, info, err, modes_changed_info)
+}
+
+// setShuffle turns shuffle on or off
+// The result json contains the modes
+// or error message if the mode is unknown
+func setShuffle(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	mode := pat.Param(ctx, "mode")
+	info, err := player.setShuffle(mode)
+	playerInfoToServiceResponse(w, []string{}, info, err, modes_changed_info)
+}
+
+// setCrossfade sets how many seconds the songs overlap, 0 turns crossfade off
+// The result json contains the modes
+// or error message if the crossfade is invalid
+func setCrossfade(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	seconds := pat.Param(ctx, "seconds")
+	info, err := player.setCrossfade(seconds)
+	playerInfoToServiceResponse(w, []string{}, info, err, modes_changed_info)
+}
+
+// removeFromQueue removes the song with the given index from the queue
+// If the song is playing, the next song is played
+// The result json contains the filename of the removed song
+// or error message if there is no such song
+func removeFromQueue(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	number := pat.Param(ctx, "index")
+	data, err := player.removeSong(number)
+	playerToServiceResponse(w, []string{data}, err, removed_from_queue_info)
+}
+
+// moveInQueue moves a song within the queue. The current song keeps playing
+// The result json contains the filename of the moved song
+// or error message if there is no such song
+func moveInQueue(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	from := pat.Param(ctx, "from")
+	to := pat.Param(ctx, "to")
+	data, err := player.moveSong(from, to)
+	playerToServiceResponse(w, []string{data}, err, moved_in_queue_info)
+}
+
+// playNext adds a song, directory or playlist to the queue right after the current song
+// Will play the songs if nothing is playing
+// The result json contains the filenames of the added songs
+// or error message if song is not found, format is unsupported or Sox cannot play the file
+func playNext(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := pat.Param(ctx, "name")
+	data, err := player.playNext(name)
+	playerToServiceResponse(w, data, err, added_to_play_next_info)
+}
+
+// clearQueue removes all songs from the queue without stopping the playback
+// The result json contains the filename of the current song that is kept in the queue
+func clearQueue(w http.ResponseWriter, r *http.Request) {
+	data := player.clearQueue()
+	playerToServiceResponse(w, data, nil, queue_cleared_info)
+}
+
+// rescanLibrary scans the music roots for new, changed and removed songs in the background
+// Only the changed files are read unless the full query parameter is true
+// The result json contains the library stats
+// or error message if there are no music roots or a scan is already running
+func rescanLibrary(w http.ResponseWriter, r *http.Request) {
+	full := r.URL.Query().Get("full") == "true"
+	info, err := player.rescanLibrary(full)
+	playerInfoToServiceResponse(w, []string{}, info, err, library_rescan_info)
+}
+
+// getLibraryStats gets the number of tracks, artists, albums and genres in the library
+// The result json contains the stats and the results of the last scan
+func getLibraryStats(w http.ResponseWriter, r *http.Request) {
+	info := player.getLibraryStats()
+	playerInfoToServiceResponse(w, []string{}, info, nil, library_stats_info)
+}
+
+// search finds the library tracks matching the q query parameter - free text
+// and artist:, album:, genre: and year: filters. The limit query parameter caps the number of results
+// The result json contains the file names and the tracks with their ids, the best matches first
+// or error message if the query is empty or the limit is invalid
+func search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data, info, err := player.search(query.Get("q"), query.Get("limit"))
+	playerInfoToServiceResponse(w, data, info, err, search_info)
+}
+
+// getArtists lists the artists of the library with the number of their albums and tracks
+// The result json contains the artists sorted by name
+// or error message if the library has no artists
+func getArtists(w http.ResponseWriter, r *http.Request) {
+	info, err := player.getArtists()
+	playerInfoToServiceResponse(w, []string{}, info, err, artists_info)
+}
+
+// getArtistAlbums lists the albums of an artist
+// The result json contains the albums with their ids sorted by year
+// or error message if the artist has no albums
+func getArtistAlbums(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	artist := pat.Param(ctx, "artist")
+	info, err := player.getArtistAlbums(artist)
+	playerInfoToServiceResponse(w, []string{}, info, err, albums_info)
+}
+
+// getAlbumTracks lists the tracks of an album
+// The result json contains the file names and the tracks with their ids sorted by disc and track number
+// or error message if there is no such album
+func getAlbumTracks(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id := pat.Param(ctx, "id")
+	data, info, err := player.getAlbumTracks(id)
+	playerInfoToServiceResponse(w, data, info, err, album_tracks_info)
+}
+
+// getGenres lists the genres of the library with the number of their tracks
+// The result json contains the genres sorted by name
+// or error message if the library has no genres
+func getGenres(w http.ResponseWriter, r *http.Request) {
+	info, err := player.getGenres()
+	playerInfoToServiceResponse(w, []string{}, info, err, genres_info)
+}
+
 func getPlaylistDir() string {
 	wd, err := os.Getwd()
 	playlistsDir := ""
@@ -243,6 +562,7 @@ func InitService(playlistDir string) *goji.Mux {
 
 	// service handle functions
 	mux := goji.NewMux()
+	mux.Use(player.authenticate)
 	mux.HandleFunc(pat.Get("/"), alive)
 	mux.HandleFuncC(pat.Put("/play/:name"), play)
 	mux.HandleFunc(pat.Post("/pause"), pause)
@@ -254,11 +574,39 @@ func InitService(playlistDir string) *goji.Mux {
 	mux.HandleFuncC(pat.Post("/add/:name"), addToQueue)
 	mux.HandleFuncC(pat.Put("/save/:name"), saveAsPlaylist)
 	mux.HandleFunc(pat.Get("/playlists"), listPlaylists)
+	mux.HandleFuncC(pat.Get("/playlists/:name"), getPlaylist)
+	mux.HandleFuncC(pat.Delete("/playlists/:name"), deletePlaylist)
+	mux.HandleFuncC(pat.Post("/playlists/:name/rename"), renamePlaylist)
+	mux.HandleFuncC(pat.Post("/playlists/:name/add/:item"), addToPlaylist)
+	mux.HandleFuncC(pat.Delete("/playlists/:name/:index"), removeFromPlaylist)
+	mux.HandleFuncC(pat.Post("/playlists/:name/move/:from/:to"), moveInPlaylist)
 	mux.HandleFunc(pat.Get("/queueinfo"), getQueueInfo)
 	mux.HandleFunc(pat.Get("/secret"), servePage)
 	mux.HandleFunc(pat.Get("/css/music_player.css"), serveCss)
 	mux.HandleFunc(pat.Get("/script/music_player.js"), serveJs)
 	mux.HandleFuncC(pat.Post("/jump/:number"), jump)
+	mux.HandleFuncC(pat.Post("/seek/:seconds"), seek)
+	mux.HandleFunc(pat.Get("/volume"), getVolume)
+	mux.HandleFunc(pat.Put("/volume/mute"), mute)
+	mux.HandleFunc(pat.Put("/volume/unmute"), unmute)
+	mux.HandleFuncC(pat.Put("/volume/:level"), setVolume)
+	mux.HandleFunc(pat.Get("/mode"), getModes)
+	mux.HandleFuncC(pat.Put("/mode/repeat/:mode"), setRepeat)
+	mux.HandleFuncC(pat.Put("/mode/shuffle/:mode"), setShuffle)
+	mux.HandleFuncC(pat.Put("/crossfade/:seconds"), setCrossfade)
+	mux.HandleFunc(pat.Delete("/queue"), clearQueue)
+	mux.HandleFuncC(pat.Delete("/queue/:index"), removeFromQueue)
+	mux.HandleFuncC(pat.Post("/queue/move/:from/:to"), moveInQueue)
+	mux.HandleFuncC(pat.Post("/playnext/:name"), playNext)
+	mux.HandleFunc(pat.Get("/events"), streamEvents)
+	mux.HandleFunc(pat.Post("/library/rescan"), rescanLibrary)
+	mux.HandleFunc(pat.Get("/library/stats"), getLibraryStats)
+	mux.HandleFunc(pat.Get("/search"), search)
+	mux.HandleFunc(pat.Get("/library/artists"), getArtists)
+	mux.HandleFuncC(pat.Get("/library/artists/:artist/albums"), getArtistAlbums)
+	mux.HandleFuncC(pat.Get("/library/albums/:id/tracks"), getAlbumTracks)
+	mux.HandleFunc(pat.Get("/library/genres"), getGenres)
+	mux.Handle(pat.Get("/ws"), websocketHandler(mux))
 
 	return mux
 }
@@ -268,17 +616,70 @@ func WaitEnd() {
 	player.waitEnd()
 }
 
-// Start starts the music_player web service
-func Start() {
+// Start starts the music_player web service with validated config (see Config.Validate)
+// Songs are played to the configured output and the state of the player is restored from the state file
+// The service is served over HTTPS if TLS is enabled
+func Start(config Config) {
+	output, err := NewOutputSink(config.Output)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
 	// init the player
-	mux := InitService(getPlaylistDir())
+	mux := InitService(config.PlaylistsDir)
+	player.output = output
+	err = player.setMusicRoots(config.MusicRoots)
+	if err != nil {
+		fmt.Println("cannot resolve music roots ", err.Error())
+		return
+	}
+	err = player.setTokens(config.Tokens)
+	if err != nil {
+		fmt.Println("invalid tokens ", err.Error())
+		return
+	}
+	if len(config.StateFile) > 0 {
+		err = player.restoreState(config.StateFile)
+		if err != nil {
+			fmt.Println("cannot restore player state ", err.Error())
+		}
+		player.readQueueTags()
+	}
+	if len(config.LibraryFile) > 0 {
+		err = player.library.load(config.LibraryFile)
+		if err != nil {
+			fmt.Println("cannot read library index ", err.Error())
+		}
+	}
+	tlsSettings, err := tlsConfig(config)
+	if err != nil {
+		fmt.Println("cannot load certificate ", err.Error())
+		return
+	}
 	// init sox
 	if !sox.Init() {
 		fmt.Println("sox is not found")
 		return
 	}
-	// clean up
+	// clean up - runs after the player is shut down
 	defer sox.Quit()
-	// start the service
-	http.ListenAndServe(":8765", mux)
+	server := &http.Server{Addr: config.ListenAddress(), Handler: mux, TLSConfig: tlsSettings}
+	if len(config.MusicRoots) > 0 {
+		// the library is brought up to date in the background (SoX reads the durations)
+		// and then follows the changes of the music roots together with the queue
+		player.rescanLibrary(false)
+		watcher := player.watchLibrary(config.LibraryPoll())
+		server.RegisterOnShutdown(watcher.close)
+	}
+	if config.MPDPort > 0 {
+		mpd, err := startMPD(config.MPDAddress())
+		if err != nil {
+			fmt.Println("cannot start MPD server ", err.Error())
+			return
+		}
+		// MPD clients are disconnected together with the web clients
+		server.RegisterOnShutdown(mpd.close)
+	}
+	// start the service and wait for SIGINT or SIGTERM
+	serve(server)
 }
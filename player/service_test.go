@@ -1,13 +1,17 @@
 package player
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"golang.org/x/net/websocket"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -21,9 +25,9 @@ func performCall(method string, url string) (string, error) {
 		res, err = http.Get(url)
 	} else if method == "POST" {
 		res, err = http.Post(url, "text/plain", nil)
-	} else if method == "PUT" {
+	} else if method == "PUT" || method == "DELETE" {
 		client := &http.Client{}
-		request, err1 := http.NewRequest("PUT", url, nil)
+		request, err1 := http.NewRequest(method, url, nil)
 		if err1 != nil {
 			return "", err1
 		}
@@ -306,8 +310,54 @@ func TestGetCurrentSongInfo(t *testing.T) {
 	performCall("PUT", play_url)
 
 	url := ts.URL + "/songinfo"
-	expected := `{"Code":0,"Message":"The filename of the current song","Data":["beep28.mp3"]}`
-	checkResult("GET", url, expected, t)
+	found, err := performCall("GET", url)
+	if err != nil {
+		t.Fatalf("Unexpected error found - %s", err.Error())
+	}
+	response := struct {
+		ResponseContainer
+		Info SongInfo
+	}{}
+	err = json.Unmarshal([]byte(found), &response)
+	if err != nil {
+		t.Fatalf("Unexpected error found - %s", err.Error())
+	}
+	checkInt(t, success, response.Code)
+	checkStr(t, "The filename of the current song", response.Message)
+	if !reflect.DeepEqual(response.Data, []string{"beep28.mp3"}) {
+		t.Errorf("Expected\n---\n[beep28.mp3]\n---\nbut found\n---\n%v\n---\n", response.Data)
+	}
+	checkStr(t, "beep28.mp3", response.Info.Name)
+	checkStr(t, "playing", response.Info.Status)
+	checkInt(t, 0, response.Info.Index)
+	checkDuration(t, 0, 0.5, response.Info.Elapsed)
+	checkDuration(t, 4.5, 4.8, response.Info.Duration)
+	if response.Info.SampleRate <= 0 || response.Info.Channels == 0 {
+		t.Errorf("Expected the signal of the song, but found %f Hz and %d channels",
+			response.Info.SampleRate, response.Info.Channels)
+	}
+}
+
+func TestGetCurrentSongInfoPaused(t *testing.T) {
+	fmt.Println("TestGetCurrentSongInfoPaused")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	play_url := ts.URL + "/play/" + escape("test_sounds")
+	performCall("PUT", play_url)
+	performCall("POST", ts.URL+"/jump/1")
+	time.Sleep(1 * time.Second)
+	performCall("POST", ts.URL+"/pause")
+
+	info, err := player.getCurrentSongInfo()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "test_sounds/beep36.mp3", info.Name)
+	checkStr(t, "paused", info.Status)
+	checkInt(t, 1, info.Index)
+	checkDuration(t, 1, 1.1, info.Elapsed)
+	player.stop()
 }
 
 func TestGetCurrentSongInfoNoPlayback(t *testing.T) {
@@ -445,7 +495,8 @@ func TestGetQueueInfo(t *testing.T) {
 	performCall("PUT", play_url)
 
 	url := ts.URL + "/queueinfo"
-	expected := `{"Code":0,"Message":"Queue content","Data":["beep28.mp3","beep36.mp3","beep9.mp3"]}`
+	expected := `{"Code":0,"Message":"Queue content","Data":["beep28.mp3","beep36.mp3","beep9.mp3"],` +
+		`"Info":{"Repeat":"off","Shuffle":false,"Current":0}}`
 	checkResult("GET", url, expected, t)
 }
 
@@ -701,6 +752,424 @@ func TestJumpNoPlayback(t *testing.T) {
 	checkResult("POST", url, expected, t)
 }
 
+func TestSeek(t *testing.T) {
+	fmt.Println("TestSeek")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	play_url := ts.URL + "/play/" + escape("test_sounds/beep28.mp3")
+	performCall("PUT", play_url)
+
+	url := ts.URL + "/seek/" + escape("+2")
+	expected := `{"Code":0,"Message":"Song position is changed","Data":["beep28.mp3"]}`
+	checkResult("POST", url, expected, t)
+}
+
+func TestSeekInvalidPosition(t *testing.T) {
+	fmt.Println("TestSeekInvalidPosition")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	play_url := ts.URL + "/play/" + escape("test_sounds/beep28.mp3")
+	performCall("PUT", play_url)
+
+	url := ts.URL + "/seek/abc"
+	expected := `{"Code":1,"Message":"Invalid seek position"}`
+	checkResult("POST", url, expected, t)
+}
+
+func TestSeekNoPlayback(t *testing.T) {
+	fmt.Println("TestSeekNoPlayback")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/seek/10"
+	expected := `{"Code":1,"Message":"Cannot seek. No song is playing or paused"}`
+	checkResult("POST", url, expected, t)
+}
+
+func TestGetVolume(t *testing.T) {
+	fmt.Println("TestGetVolume")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/volume"
+	expected := `{"Code":0,"Message":"Volume of the player","Info":{"Percent":100,"Decibels":0,"Muted":false}}`
+	checkResult("GET", url, expected, t)
+}
+
+func TestSetVolume(t *testing.T) {
+	fmt.Println("TestSetVolume")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	play_url := ts.URL + "/play/" + escape("test_sounds/beep28.mp3")
+	performCall("PUT", play_url)
+
+	url := ts.URL + "/volume/0"
+	expected := `{"Code":0,"Message":"Volume is changed","Info":{"Percent":0,"Muted":false}}`
+	checkResult("PUT", url, expected, t)
+}
+
+func TestSetInvalidVolume(t *testing.T) {
+	fmt.Println("TestSetInvalidVolume")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/volume/150"
+	expected := `{"Code":1,"Message":"Invalid volume. Use 0-100 percent or dB up to 0"}`
+	checkResult("PUT", url, expected, t)
+}
+
+func TestMute(t *testing.T) {
+	fmt.Println("TestMute")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/volume/mute"
+	expected := `{"Code":0,"Message":"Player is muted","Info":{"Percent":100,"Decibels":0,"Muted":true}}`
+	checkResult("PUT", url, expected, t)
+
+	url = ts.URL + "/volume/unmute"
+	expected = `{"Code":0,"Message":"Player is unmuted","Info":{"Percent":100,"Decibels":0,"Muted":false}}`
+	checkResult("PUT", url, expected, t)
+}
+
+func TestGetModes(t *testing.T) {
+	fmt.Println("TestGetModes")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/mode"
+	expected := `{"Code":0,"Message":"Repeat and shuffle modes","Info":{"Repeat":"off","Shuffle":false}}`
+	checkResult("GET", url, expected, t)
+}
+
+func TestSetModes(t *testing.T) {
+	fmt.Println("TestSetModes")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/mode/repeat/all"
+	expected := `{"Code":0,"Message":"Mode is changed","Info":{"Repeat":"all","Shuffle":false}}`
+	checkResult("PUT", url, expected, t)
+
+	url = ts.URL + "/mode/shuffle/on"
+	expected = `{"Code":0,"Message":"Mode is changed","Info":{"Repeat":"all","Shuffle":true}}`
+	checkResult("PUT", url, expected, t)
+}
+
+func TestSetInvalidModes(t *testing.T) {
+	fmt.Println("TestSetInvalidModes")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/mode/repeat/twice"
+	expected := `{"Code":1,"Message":"Invalid repeat mode. Use off, one or all"}`
+	checkResult("PUT", url, expected, t)
+
+	url = ts.URL + "/mode/shuffle/maybe"
+	expected = `{"Code":1,"Message":"Invalid shuffle mode. Use on or off"}`
+	checkResult("PUT", url, expected, t)
+}
+
+func TestNextRepeatAll(t *testing.T) {
+	fmt.Println("TestNextRepeatAll")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	performCall("PUT", ts.URL+"/mode/repeat/all")
+	performCall("PUT", ts.URL+"/play/"+escape("test_sounds"))
+	performCall("POST", ts.URL+"/jump/2")
+
+	url := ts.URL + "/next"
+	expected := `{"Code":0,"Message":"Started playing","Data":["beep28.mp3"]}`
+	checkResult("POST", url, expected, t)
+	performCall("PUT", ts.URL+"/stop")
+}
+
+func TestRemoveFromQueue(t *testing.T) {
+	fmt.Println("TestRemoveFromQueue")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	performCall("PUT", ts.URL+"/play/"+escape("test_sounds"))
+
+	url := ts.URL + "/queue/1"
+	expected := `{"Code":0,"Message":"Removed from queue","Data":["beep36.mp3"]}`
+	checkResult("DELETE", url, expected, t)
+
+	url = ts.URL + "/queueinfo"
+	expected = `{"Code":0,"Message":"Queue content","Data":["beep28.mp3","beep9.mp3"],` +
+		`"Info":{"Repeat":"off","Shuffle":false,"Current":0}}`
+	checkResult("GET", url, expected, t)
+	performCall("PUT", ts.URL+"/stop")
+}
+
+func TestRemoveCurrentFromQueue(t *testing.T) {
+	fmt.Println("TestRemoveCurrentFromQueue")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	performCall("PUT", ts.URL+"/play/"+escape("test_sounds"))
+
+	url := ts.URL + "/queue/0"
+	expected := `{"Code":0,"Message":"Removed from queue","Data":["beep28.mp3"]}`
+	checkResult("DELETE", url, expected, t)
+
+	url = ts.URL + "/songinfo"
+	found, _ := performCall("GET", url)
+	if !strings.Contains(found, `"Name":"beep36.mp3","Status":"playing"`) {
+		t.Errorf("Expected beep36.mp3 to be playing, but found\n---\n%s\n---\n", found)
+	}
+	performCall("PUT", ts.URL+"/stop")
+}
+
+func TestRemoveFromQueueInvalid(t *testing.T) {
+	fmt.Println("TestRemoveFromQueueInvalid")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/queue/0"
+	expected := `{"Code":1,"Message":"Cannot remove. Song not available"}`
+	checkResult("DELETE", url, expected, t)
+}
+
+func TestMoveInQueue(t *testing.T) {
+	fmt.Println("TestMoveInQueue")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	performCall("PUT", ts.URL+"/play/"+escape("test_sounds"))
+
+	url := ts.URL + "/queue/move/2/0"
+	expected := `{"Code":0,"Message":"Moved in queue","Data":["beep9.mp3"]}`
+	checkResult("POST", url, expected, t)
+
+	url = ts.URL + "/queueinfo"
+	expected = `{"Code":0,"Message":"Queue content","Data":["beep9.mp3","beep28.mp3","beep36.mp3"],` +
+		`"Info":{"Repeat":"off","Shuffle":false,"Current":1}}`
+	checkResult("GET", url, expected, t)
+	performCall("PUT", ts.URL+"/stop")
+}
+
+func TestMoveInQueueInvalid(t *testing.T) {
+	fmt.Println("TestMoveInQueueInvalid")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	performCall("PUT", ts.URL+"/play/"+escape("test_sounds"))
+
+	url := ts.URL + "/queue/move/0/3"
+	expected := `{"Code":1,"Message":"Cannot move. Song not available"}`
+	checkResult("POST", url, expected, t)
+	performCall("PUT", ts.URL+"/stop")
+}
+
+func TestPlayNext(t *testing.T) {
+	fmt.Println("TestPlayNext")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	performCall("PUT", ts.URL+"/play/"+escape("test_sounds"))
+
+	url := ts.URL + "/playnext/" + escape("test_sounds/beep9.mp3")
+	expected := `{"Code":0,"Message":"Added to be played next","Data":["beep9.mp3"]}`
+	checkResult("POST", url, expected, t)
+
+	url = ts.URL + "/queueinfo"
+	expected = `{"Code":0,"Message":"Queue content","Data":["beep28.mp3","beep9.mp3","beep36.mp3","beep9.mp3"],` +
+		`"Info":{"Repeat":"off","Shuffle":false,"Current":0}}`
+	checkResult("GET", url, expected, t)
+	performCall("PUT", ts.URL+"/stop")
+}
+
+func TestPlayNextNoPlayback(t *testing.T) {
+	fmt.Println("TestPlayNextNoPlayback")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	url := ts.URL + "/playnext/" + escape("test_sounds/beep9.mp3")
+	expected := `{"Code":0,"Message":"Added to be played next","Data":["beep9.mp3"]}`
+	checkResult("POST", url, expected, t)
+}
+
+func TestClearQueue(t *testing.T) {
+	fmt.Println("TestClearQueue")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	performCall("PUT", ts.URL+"/play/"+escape("test_sounds"))
+
+	url := ts.URL + "/queue"
+	expected := `{"Code":0,"Message":"Queue is cleared","Data":["beep28.mp3"]}`
+	checkResult("DELETE", url, expected, t)
+
+	url = ts.URL + "/queueinfo"
+	expected = `{"Code":0,"Message":"Queue content","Data":["beep28.mp3"],` +
+		`"Info":{"Repeat":"off","Shuffle":false,"Current":0}}`
+	checkResult("GET", url, expected, t)
+	performCall("PUT", ts.URL+"/stop")
+}
+
+func TestLibraryStats(t *testing.T) {
+	fmt.Println("TestLibraryStats")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+
+	url := ts.URL + "/library/stats"
+	expected := `{"Code":0,"Message":"Library statistics","Info":{"Tracks":0,"Artists":0,"Albums":0,"Genres":0,` +
+		`"Duration":0,"Size":0,"Scanning":false,"ScanSeconds":0,"Added":0,"Updated":0,"Removed":0}}`
+	checkResult("GET", url, expected, t)
+
+	url = ts.URL + "/library/rescan"
+	expected = `{"Code":1,"Message":"No music roots to scan"}`
+	checkResult("POST", url, expected, t)
+}
+
+func TestSearchService(t *testing.T) {
+	fmt.Println("TestSearchService")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+
+	url := ts.URL + "/search?q=beep"
+	expected := `{"Code":0,"Message":"Search results","Info":[]}`
+	checkResult("GET", url, expected, t)
+
+	url = ts.URL + "/search?q=" + escape(" ")
+	expected = `{"Code":1,"Message":"Search query is empty"}`
+	checkResult("GET", url, expected, t)
+}
+
+func TestBrowseLibrary(t *testing.T) {
+	fmt.Println("TestBrowseLibrary")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+
+	checkResult("GET", ts.URL+"/library/artists", `{"Code":1,"Message":"There are no artists in the library"}`, t)
+	checkResult("GET", ts.URL+"/library/artists/Tester/albums", `{"Code":1,"Message":"Artist cannot be found"}`, t)
+	checkResult("GET", ts.URL+"/library/albums/album:0000000000000000/tracks",
+		`{"Code":1,"Message":"Album cannot be found"}`, t)
+	checkResult("GET", ts.URL+"/library/genres", `{"Code":1,"Message":"There are no genres in the library"}`, t)
+}
+
+func TestPlaylistManagement(t *testing.T) {
+	fmt.Println("TestPlaylistManagement")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+	err := ioutil.WriteFile(player.playlistsDir+"tests_tmp.m3u", []byte("test_sounds/beep9.mp3\ntest_sounds/beep28.mp3\n"), 0666)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.Remove(player.playlistsDir + "tests_tmp.m3u")
+	defer os.Remove(player.playlistsDir + "tests_tmp2.m3u")
+
+	url := ts.URL + "/playlists/tests_tmp.m3u"
+	checkResult("GET", url, `{"Code":0,"Message":"Playlist content","Data":["beep9.mp3","beep28.mp3"],`+
+		`"Info":[{"Name":"beep9.mp3"},{"Name":"beep28.mp3"}]}`, t)
+	checkResult("POST", url+"/add/"+escape("test_sounds/beep36.mp3"),
+		`{"Code":0,"Message":"Added to playlist","Data":["beep36.mp3"]}`, t)
+	checkResult("POST", url+"/move/2/0", `{"Code":0,"Message":"Moved in playlist","Data":["beep36.mp3"]}`, t)
+	checkResult("DELETE", url+"/1", `{"Code":0,"Message":"Removed from playlist","Data":["beep9.mp3"]}`, t)
+	checkResult("DELETE", url+"/5", `{"Code":1,"Message":"Playlist entry not available"}`, t)
+	checkResult("GET", url, `{"Code":0,"Message":"Playlist content","Data":["beep36.mp3","beep28.mp3"],`+
+		`"Info":[{"Name":"beep36.mp3"},{"Name":"beep28.mp3"}]}`, t)
+	checkResult("GET", ts.URL+"/queueinfo", `{"Code":1,"Message":"Cannot get queue info. Queue is empty"}`, t)
+
+	checkResult("POST", url+"/rename?to=tests_tmp2", `{"Code":0,"Message":"Playlist is renamed","Data":["tests_tmp2.m3u"]}`, t)
+	checkResult("GET", url, `{"Code":1,"Message":"Playlist cannot be found"}`, t)
+	checkResult("DELETE", ts.URL+"/playlists/tests_tmp2.m3u",
+		`{"Code":0,"Message":"Playlist is deleted","Data":["tests_tmp2.m3u"]}`, t)
+}
+
 func escape(urlPath string) string {
 	return strings.Replace(url.QueryEscape(urlPath), "+", "%20", -1)
 }
+
+func TestEvents(t *testing.T) {
+	fmt.Println("TestEvents")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+
+	res, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer res.Body.Close()
+	checkStr(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	checkResult("PUT", ts.URL+"/mode/repeat/all", `{"Code":0,"Message":"Mode is changed","Info":{"Repeat":"all","Shuffle":false}}`, t)
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	expected := []string{": connected", "", "event: mode", `data: {"Type":"mode","Info":{"Repeat":"all","Shuffle":false}}`}
+	for _, line := range expected {
+		select {
+		case found := <-lines:
+			checkStr(t, line, found)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected line %q", line)
+		}
+	}
+
+	path, _ := filepath.Abs("test_sounds/beep9.mp3")
+	player.Lock()
+	player.state.queue = []string{path}
+	player.publishSong(eventPaused)
+	player.Unlock()
+	expectedPrefixes := []string{"", "event: paused", `data: {"Type":"paused","Data":["beep9.mp3"],"Info":{"Name":"beep9.mp3",`}
+	for _, prefix := range expectedPrefixes {
+		select {
+		case found := <-lines:
+			if !strings.HasPrefix(found, prefix) {
+				t.Errorf("Expected a line starting with %q but found %q", prefix, found)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected line %q", prefix)
+		}
+	}
+}
+
+func TestWebsocket(t *testing.T) {
+	fmt.Println("TestWebsocket")
+	ts := httptest.NewServer(InitService(getTestPlaylistDir()))
+	defer ts.Close()
+	defer WaitEnd()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", "", ts.URL)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(2 * time.Second))
+
+	err = websocket.JSON.Send(ws, map[string]interface{}{"Id": "1", "Action": "repeat", "Args": []string{"all"}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the response and the event of the change can come in any order
+	found := make(map[string]string)
+	for len(found) < 2 {
+		var message string
+		err = websocket.Message.Receive(ws, &message)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if strings.Contains(message, `"Action"`) {
+			found["response"] = message
+		} else {
+			found["event"] = message
+		}
+	}
+	checkStr(t, `{"Id":"1","Action":"repeat","Code":0,"Message":"Mode is changed","Info":{"Repeat":"all","Shuffle":false}}`,
+		found["response"])
+	checkStr(t, `{"Type":"mode","Info":{"Repeat":"all","Shuffle":false}}`, found["event"])
+}
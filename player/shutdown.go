@@ -0,0 +1,69 @@
+package player
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long in-flight requests are given to finish on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// serve runs the web service (over HTTPS if the server has TLSConfig) until SIGINT or SIGTERM is received or the server fails
+// Then it stops accepting requests, drains the in-flight ones and shuts the player down
+func serve(server *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// event streams never become idle by themselves
+	server.RegisterOnShutdown(player.closeEvents)
+
+	errs := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			// the certificate is already in TLSConfig
+			errs <- server.ListenAndServeTLS("", "")
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case sig := <-signals:
+		fmt.Println("received", sig, "- shutting down")
+	case err := <-errs:
+		fmt.Println("web service stopped ", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if err != nil {
+		fmt.Println("cannot drain requests ", err.Error())
+	}
+	player.shutdown()
+}
+
+// shutdown stops the playback keeping the position of the current song and the library scan,
+// waits for the chain and the scan to end and saves the state
+func (player *musicPlayer) shutdown() {
+	player.Lock()
+	if player.state.status == playing {
+		player.stopFlow()
+	}
+	player.Unlock()
+
+	player.waitEnd()
+	player.releaseOutput()
+	player.library.close()
+
+	err := player.saveState()
+	if err != nil {
+		fmt.Println("cannot save player state ", err.Error())
+	}
+}
@@ -0,0 +1,44 @@
+package player
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownKeepsPosition(t *testing.T) {
+	fmt.Println("TestShutdownKeepsPosition")
+	defer os.Remove(testStateFile)
+	initTestPlayer(t)
+	player.stateFile = testStateFile
+	player.play("test_sounds/beep28.mp3")
+	time.Sleep(1 * time.Second)
+	player.shutdown()
+	checkInt(t, paused, player.state.status)
+
+	initTestPlayer(t)
+	player.restoreState(testStateFile)
+	checkInt(t, 1, len(player.state.queue))
+	checkDuration(t, 1, 1.1, player.state.durationPaused.Seconds())
+}
+
+func TestServeStopsOnSignal(t *testing.T) {
+	fmt.Println("TestServeStopsOnSignal")
+	initTestPlayer(t)
+	done := make(chan bool)
+	go func() {
+		serve(&http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()})
+		done <- true
+	}()
+	time.Sleep(100 * time.Millisecond)
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the service to stop")
+	}
+}
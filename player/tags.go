@@ -0,0 +1,523 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tags holds the metadata of a song read from its ID3, Vorbis comment or FLAC tags
+type Tags struct {
+	Title  string `json:"Title,omitempty"`
+	Artist string `json:"Artist,omitempty"`
+	Album  string `json:"Album,omitempty"`
+	// Artist of the whole album e.g. "Various Artists" for compilations
+	AlbumArtist string `json:"AlbumArtist,omitempty"`
+	// Track and disc number in the album. 0 if not known
+	Track int    `json:"Track,omitempty"`
+	Disc  int    `json:"Disc,omitempty"`
+	Year  string `json:"Year,omitempty"`
+	Genre string `json:"Genre,omitempty"`
+}
+
+// isEmpty checks if no tag is known
+func (tags Tags) isEmpty() bool {
+	return tags == Tags{}
+}
+
+// merge fills the tags that are not known with the ones from other
+func (tags *Tags) merge(other Tags) {
+	if len(tags.Title) == 0 {
+		tags.Title = other.Title
+	}
+	if len(tags.Artist) == 0 {
+		tags.Artist = other.Artist
+	}
+	if len(tags.Album) == 0 {
+		tags.Album = other.Album
+	}
+	if len(tags.AlbumArtist) == 0 {
+		tags.AlbumArtist = other.AlbumArtist
+	}
+	if tags.Track == 0 {
+		tags.Track = other.Track
+	}
+	if tags.Disc == 0 {
+		tags.Disc = other.Disc
+	}
+	if len(tags.Year) == 0 {
+		tags.Year = other.Year
+	}
+	if len(tags.Genre) == 0 {
+		tags.Genre = other.Genre
+	}
+}
+
+// songTags returns the tags of a song in the queue that were read by readQueueTags
+// Returns the title of the extended M3U playlist the song was added from if the song has no tags
+// or empty tags if it has neither or they are not read yet
+func (player *musicPlayer) songTags(fileName string) Tags {
+	// Warning: never call this if the player is not locked
+	tags := player.tags[fileName]
+	if entry, ok := player.playlistInfo[fileName]; ok && tags.isEmpty() && len(entry.Title) > 0 {
+		// the title of an extended M3U playlist is shown for the songs without tags
+		return titleTags(entry.Title)
+	}
+	return tags
+}
+
+// readQueueTags reads the tags of the songs in the queue that are not known yet
+// The files are read while the player is not locked, so that adding many songs does not hold it
+func (player *musicPlayer) readQueueTags() {
+	player.Lock()
+	unknown := make(map[string]bool)
+	for _, song := range player.state.queue {
+		if _, ok := player.tags[song]; !ok {
+			unknown[song] = true
+		}
+	}
+	player.Unlock()
+	if len(unknown) == 0 {
+		return
+	}
+
+	read := make(map[string]Tags, len(unknown))
+	for song := range unknown {
+		read[song], _ = readTags(song)
+	}
+
+	player.Lock()
+	defer player.Unlock()
+	if player.tags == nil {
+		return
+	}
+	queued := make(map[string]bool, len(player.state.queue))
+	for _, song := range player.state.queue {
+		queued[song] = true
+	}
+	for song, tags := range read {
+		// the songs removed meanwhile are not kept
+		if _, ok := player.tags[song]; !ok && queued[song] {
+			player.tags[song] = tags
+		}
+	}
+}
+
+// forgetTags forgets the tags of the songs that left the queue
+func (player *musicPlayer) forgetTags() {
+	// Warning: never call this if the player is not locked
+	if len(player.tags) == 0 {
+		return
+	}
+	queued := make(map[string]bool, len(player.state.queue))
+	for _, song := range player.state.queue {
+		queued[song] = true
+	}
+	for song := range player.tags {
+		if !queued[song] {
+			delete(player.tags, song)
+		}
+	}
+}
+
+// maxTagSize limits how much of a file is read for its tags
+const maxTagSize = 1 << 20
+
+// readTags reads the tags of a song. ID3v2 is preferred to ID3v1 for mp3 files
+// Returns error if the file cannot be read or has no tags
+func readTags(path string) (Tags, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Tags{}, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return Tags{}, errors.New(no_tags_msg)
+	}
+	file.Seek(0, io.SeekStart)
+
+	var tags Tags
+	switch {
+	case string(magic) == "fLaC":
+		tags = readFlacTags(file)
+	case string(magic) == "OggS":
+		tags = readOggTags(file)
+	default:
+		if string(magic[:3]) == "ID3" {
+			tags = readID3v2(file)
+		}
+		tags.merge(readID3v1(file))
+	}
+	if tags.isEmpty() {
+		return tags, errors.New(no_tags_msg)
+	}
+	return tags, nil
+}
+
+// readID3v2 reads an ID3v2.2, v2.3 or v2.4 tag at the beginning of the file
+func readID3v2(file io.Reader) Tags {
+	tags := Tags{}
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return tags
+	}
+	version, flags := header[3], header[5]
+	size := syncsafe(header[6:10])
+	if version < 2 || version > 4 || size > maxTagSize {
+		return tags
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return tags
+	}
+	if flags&0x80 != 0 && version < 4 {
+		// the whole tag is unsynchronised - in v2.4 it is done per frame
+		data = bytes.Replace(data, []byte{0xff, 0x00}, []byte{0xff}, -1)
+	}
+	if flags&0x40 != 0 && version > 2 && len(data) >= 4 {
+		// skip the extended header
+		extended := int(binary.BigEndian.Uint32(data[:4]))
+		if version == 4 {
+			extended = syncsafe(data[:4])
+		} else {
+			extended += 4
+		}
+		if extended > len(data) {
+			return tags
+		}
+		data = data[extended:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(data) >= headerSize && data[0] != 0 {
+		id := string(data[:idSize])
+		var frameSize int
+		skip := false
+		switch version {
+		case 2:
+			frameSize = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(data[4:8]))
+			skip = data[9]&0xc0 != 0
+		case 4:
+			frameSize = syncsafe(data[4:8])
+			skip = data[9]&0x0c != 0
+		}
+		if frameSize < 0 || headerSize+frameSize > len(data) {
+			break
+		}
+		frame := data[headerSize : headerSize+frameSize]
+		if version == 4 && data[9]&0x02 != 0 {
+			frame = bytes.Replace(frame, []byte{0xff, 0x00}, []byte{0xff}, -1)
+		}
+		if version == 4 && data[9]&0x01 != 0 && len(frame) >= 4 {
+			// data length indicator
+			frame = frame[4:]
+		}
+		data = data[headerSize+frameSize:]
+		if skip || len(frame) == 0 {
+			// compressed or encrypted frames are skipped
+			continue
+		}
+
+		value := id3Text(frame)
+		switch id {
+		case "TIT2", "TT2":
+			tags.Title = value
+		case "TPE1", "TP1":
+			tags.Artist = value
+		case "TALB", "TAL":
+			tags.Album = value
+		case "TPE2", "TP2":
+			tags.AlbumArtist = value
+		case "TRCK", "TRK":
+			tags.Track = trackNumber(value)
+		case "TPOS", "TPA":
+			tags.Disc = trackNumber(value)
+		case "TYER", "TYE", "TDRC":
+			if len(value) >= 4 {
+				tags.Year = value[:4]
+			}
+		case "TCON", "TCO":
+			tags.Genre = id3Genre(value)
+		}
+	}
+	return tags
+}
+
+// syncsafe decodes a 4 byte integer with 7 bits in every byte
+func syncsafe(data []byte) int {
+	return int(data[0]&0x7f)<<21 | int(data[1]&0x7f)<<14 | int(data[2]&0x7f)<<7 | int(data[3]&0x7f)
+}
+
+// id3Text decodes a text frame. The first byte is the encoding -
+// 0 ISO-8859-1, 1 UTF-16 with BOM, 2 UTF-16BE, 3 UTF-8
+// Only the first of several values (separated by 0) is returned
+func id3Text(frame []byte) string {
+	encoding, text := frame[0], frame[1:]
+	var value string
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+			bigEndian, text = true, text[2:]
+		} else if len(text) >= 2 && text[0] == 0xff && text[1] == 0xfe {
+			bigEndian, text = false, text[2:]
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			var unit uint16
+			if bigEndian {
+				unit = binary.BigEndian.Uint16(text[i:])
+			} else {
+				unit = binary.LittleEndian.Uint16(text[i:])
+			}
+			if unit == 0 {
+				break
+			}
+			units = append(units, unit)
+		}
+		value = string(utf16.Decode(units))
+	case 3:
+		value = string(text)
+	default:
+		value = latin1(text)
+	}
+	if i := strings.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
+
+// latin1 decodes ISO-8859-1 text
+func latin1(text []byte) string {
+	runes := make([]rune, 0, len(text))
+	for _, b := range text {
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
+
+// trackNumber parses a track or disc number like "3" or "3/12"
+// Returns 0 if it is not a number
+func trackNumber(value string) int {
+	if i := strings.Index(value, "/"); i >= 0 {
+		value = value[:i]
+	}
+	track, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || track < 0 {
+		return 0
+	}
+	return track
+}
+
+// id3Genre resolves genre references like "(17)" or "17" to the ID3v1 genre names
+func id3Genre(value string) string {
+	reference := value
+	if strings.HasPrefix(value, "(") {
+		end := strings.Index(value, ")")
+		if end < 0 {
+			return value
+		}
+		if end+1 < len(value) {
+			// "(17)Rock" - the refinement is the name
+			return value[end+1:]
+		}
+		reference = value[1:end]
+	}
+	if index, err := strconv.Atoi(reference); err == nil {
+		if index >= 0 && index < len(id3v1Genres) {
+			return id3v1Genres[index]
+		}
+		return ""
+	}
+	return value
+}
+
+// readID3v1 reads the 128 byte ID3v1 tag at the end of the file
+// A tag without title, artist and album is ignored as encoders often write blank ones
+func readID3v1(file io.ReadSeeker) Tags {
+	tags := Tags{}
+	if _, err := file.Seek(-128, io.SeekEnd); err != nil {
+		return tags
+	}
+	data := make([]byte, 128)
+	if _, err := io.ReadFull(file, data); err != nil || string(data[:3]) != "TAG" {
+		return tags
+	}
+	field := func(from int, to int) string {
+		value := data[from:to]
+		if i := bytes.IndexByte(value, 0); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(latin1(value))
+	}
+	tags.Title = field(3, 33)
+	tags.Artist = field(33, 63)
+	tags.Album = field(63, 93)
+	if len(tags.Title) == 0 && len(tags.Artist) == 0 && len(tags.Album) == 0 {
+		return Tags{}
+	}
+	tags.Year = field(93, 97)
+	if data[125] == 0 && data[126] != 0 {
+		// ID3v1.1 keeps the track number at the end of the comment
+		tags.Track = int(data[126])
+	}
+	if int(data[127]) < len(id3v1Genres) {
+		tags.Genre = id3v1Genres[data[127]]
+	}
+	return tags
+}
+
+// readFlacTags reads the Vorbis comment block of a FLAC file
+func readFlacTags(file io.Reader) Tags {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return Tags{}
+	}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(file, header); err != nil {
+			return Tags{}
+		}
+		last, blockType := header[0]&0x80 != 0, header[0]&0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if size > maxTagSize {
+			return Tags{}
+		}
+		block := make([]byte, size)
+		if _, err := io.ReadFull(file, block); err != nil {
+			return Tags{}
+		}
+		if blockType == 4 {
+			return vorbisComments(block)
+		}
+		if last {
+			return Tags{}
+		}
+	}
+}
+
+// readOggTags reads the comment header of an Ogg Vorbis or Opus file
+// It is the second packet of the stream
+func readOggTags(file io.Reader) Tags {
+	packets := make([][]byte, 0, 2)
+	packet := make([]byte, 0)
+	header := make([]byte, 27)
+	read := 0
+	for len(packets) < 2 && read < maxTagSize {
+		if _, err := io.ReadFull(file, header); err != nil || string(header[:4]) != "OggS" {
+			return Tags{}
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(file, segments); err != nil {
+			return Tags{}
+		}
+		for _, lacing := range segments {
+			segment := make([]byte, lacing)
+			if _, err := io.ReadFull(file, segment); err != nil {
+				return Tags{}
+			}
+			read += int(lacing)
+			packet = append(packet, segment...)
+			// a segment shorter than 255 ends the packet
+			if lacing < 255 {
+				packets = append(packets, packet)
+				packet = make([]byte, 0)
+			}
+		}
+	}
+	if len(packets) < 2 {
+		return Tags{}
+	}
+	comments := packets[1]
+	switch {
+	case bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		return vorbisComments(comments[7:])
+	case bytes.HasPrefix(comments, []byte("OpusTags")):
+		return vorbisComments(comments[8:])
+	}
+	return Tags{}
+}
+
+// vorbisComments parses a Vorbis comment block - vendor string and a list of NAME=value
+// with little endian lengths
+func vorbisComments(block []byte) Tags {
+	tags := Tags{}
+	next := func() ([]byte, bool) {
+		if len(block) < 4 {
+			return nil, false
+		}
+		length := int(binary.LittleEndian.Uint32(block[:4]))
+		if length < 0 || 4+length > len(block) {
+			return nil, false
+		}
+		value := block[4 : 4+length]
+		block = block[4+length:]
+		return value, true
+	}
+	if _, ok := next(); !ok {
+		return tags
+	}
+	if len(block) < 4 {
+		return tags
+	}
+	count := int(binary.LittleEndian.Uint32(block[:4]))
+	block = block[4:]
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		parts := strings.SplitN(string(comment), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.ToUpper(parts[0]) {
+		case "TITLE":
+			tags.Title = value
+		case "ARTIST":
+			tags.Artist = value
+		case "ALBUM":
+			tags.Album = value
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			tags.AlbumArtist = value
+		case "TRACKNUMBER":
+			tags.Track = trackNumber(value)
+		case "DISCNUMBER":
+			tags.Disc = trackNumber(value)
+		case "DATE", "YEAR":
+			if len(value) >= 4 {
+				tags.Year = value[:4]
+			}
+		case "GENRE":
+			tags.Genre = value
+		}
+	}
+	return tags
+}
+
+// id3v1Genres are the genres of the ID3v1 specification
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal",
+	"New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial",
+	"Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop",
+	"Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical", "Instrumental", "Acid", "House", "Game",
+	"Sound Clip", "Gospel", "Noise", "AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave", "Techno-Industrial",
+	"Electronic", "Pop-Folk", "Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40",
+	"Christian Rap", "Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave", "Psychadelic", "Rave",
+	"Showtunes", "Trailer", "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical",
+	"Rock & Roll", "Hard Rock",
+}
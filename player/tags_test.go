@@ -0,0 +1,267 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFile writes the data to a file in dir and returns its path
+func writeTestFile(t *testing.T, dir string, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return path
+}
+
+// id3v2Frame creates an ID3v2.3 or v2.4 text frame
+func id3v2Frame(version byte, id string, encoding byte, text []byte) []byte {
+	frame := bytes.NewBufferString(id)
+	size := len(text) + 1
+	if version == 4 {
+		frame.Write([]byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	} else {
+		binary.Write(frame, binary.BigEndian, uint32(size))
+	}
+	frame.Write([]byte{0, 0, encoding})
+	frame.Write(text)
+	return frame.Bytes()
+}
+
+// id3v2Tag creates an ID3v2 tag with the frames followed by some audio data
+func id3v2Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	size := len(body)
+	tag := bytes.NewBufferString("ID3")
+	tag.Write([]byte{version, 0, 0})
+	tag.Write([]byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	tag.Write(body)
+	tag.Write(make([]byte, 256))
+	return tag.Bytes()
+}
+
+// id3v1Tag creates an ID3v1.1 tag
+func id3v1Tag(title string, artist string, album string, year string, track byte, genre byte) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:], title)
+	copy(tag[33:], artist)
+	copy(tag[63:], album)
+	copy(tag[93:], year)
+	tag[126] = track
+	tag[127] = genre
+	return tag
+}
+
+// vorbisCommentBlock creates a Vorbis comment block with the comments
+func vorbisCommentBlock(comments ...string) []byte {
+	block := &bytes.Buffer{}
+	binary.Write(block, binary.LittleEndian, uint32(len("test vendor")))
+	block.WriteString("test vendor")
+	binary.Write(block, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		binary.Write(block, binary.LittleEndian, uint32(len(comment)))
+		block.WriteString(comment)
+	}
+	return block.Bytes()
+}
+
+// oggPage creates an Ogg page with a single packet
+func oggPage(packet []byte) []byte {
+	page := bytes.NewBufferString("OggS")
+	page.Write(make([]byte, 22))
+	segments := make([]byte, 0)
+	rest := len(packet)
+	for rest >= 255 {
+		segments = append(segments, 255)
+		rest -= 255
+	}
+	segments = append(segments, byte(rest))
+	page.WriteByte(byte(len(segments)))
+	page.Write(segments)
+	page.Write(packet)
+	return page.Bytes()
+}
+
+func TestReadID3v2Tags(t *testing.T) {
+	fmt.Println("TestReadID3v2Tags")
+	dir, err := ioutil.TempDir("", "music_player_tags")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// UTF-16 with BOM, ISO-8859-1 and a genre reference
+	path := writeTestFile(t, dir, "v3.mp3", id3v2Tag(3,
+		id3v2Frame(3, "TIT2", 1, []byte{0xff, 0xfe, 'B', 0, 'e', 0, 'e', 0, 'p', 0}),
+		id3v2Frame(3, "TPE1", 0, []byte("Tester")),
+		id3v2Frame(3, "TALB", 0, []byte("Caf\xe9")),
+		id3v2Frame(3, "TRCK", 0, []byte("3/12")),
+		id3v2Frame(3, "TYER", 0, []byte("2017")),
+		id3v2Frame(3, "TCON", 0, []byte("(39)"))))
+	tags, err := readTags(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "Beep", tags.Title)
+	checkStr(t, "Tester", tags.Artist)
+	checkStr(t, "Café", tags.Album)
+	checkInt(t, 3, tags.Track)
+	checkStr(t, "2017", tags.Year)
+	checkStr(t, "Noise", tags.Genre)
+
+	// UTF-8 and a recording time instead of the year
+	path = writeTestFile(t, dir, "v4.mp3", id3v2Tag(4,
+		id3v2Frame(4, "TIT2", 3, []byte("Beep ♪")),
+		id3v2Frame(4, "TDRC", 3, []byte("2018-05-01"))))
+	tags, err = readTags(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "Beep ♪", tags.Title)
+	checkStr(t, "2018", tags.Year)
+}
+
+func TestReadID3v1Tags(t *testing.T) {
+	fmt.Println("TestReadID3v1Tags")
+	dir, err := ioutil.TempDir("", "music_player_tags")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	data := append(make([]byte, 512), id3v1Tag("Beep", "Tester", "Beeps", "2016", 7, 17)...)
+	tags, err := readTags(writeTestFile(t, dir, "v1.mp3", data))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "Beep", tags.Title)
+	checkStr(t, "Tester", tags.Artist)
+	checkStr(t, "Beeps", tags.Album)
+	checkInt(t, 7, tags.Track)
+	checkStr(t, "2016", tags.Year)
+	checkStr(t, "Rock", tags.Genre)
+
+	// ID3v2 wins, ID3v1 fills the gaps
+	data = append(id3v2Tag(3, id3v2Frame(3, "TIT2", 0, []byte("Longer Beep"))), data...)
+	tags, err = readTags(writeTestFile(t, dir, "both.mp3", data))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "Longer Beep", tags.Title)
+	checkStr(t, "Tester", tags.Artist)
+
+	// blank tags written by encoders are ignored
+	data = append(make([]byte, 512), id3v1Tag("", "", "", "", 0, 12)...)
+	_, err = readTags(writeTestFile(t, dir, "blank.mp3", data))
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestReadFlacTags(t *testing.T) {
+	fmt.Println("TestReadFlacTags")
+	dir, err := ioutil.TempDir("", "music_player_tags")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.NewBufferString("fLaC")
+	// STREAMINFO and then the last block with the comments
+	data.Write([]byte{0, 0, 0, 34})
+	data.Write(make([]byte, 34))
+	comments := vorbisCommentBlock("TITLE=Beep", "artist=Tester", "ALBUM=Beeps", "TRACKNUMBER=2", "DATE=2015-01-01",
+		"GENRE=Noise", "COMMENT=ignored")
+	data.Write([]byte{0x84, 0, byte(len(comments) >> 8), byte(len(comments))})
+	data.Write(comments)
+
+	tags, err := readTags(writeTestFile(t, dir, "beep.flac", data.Bytes()))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "Beep", tags.Title)
+	checkStr(t, "Tester", tags.Artist)
+	checkStr(t, "Beeps", tags.Album)
+	checkInt(t, 2, tags.Track)
+	checkStr(t, "2015", tags.Year)
+	checkStr(t, "Noise", tags.Genre)
+}
+
+func TestReadOggTags(t *testing.T) {
+	fmt.Println("TestReadOggTags")
+	dir, err := ioutil.TempDir("", "music_player_tags")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// the comments are longer than a segment so that the packet is split
+	long := "COMMENT=" + string(bytes.Repeat([]byte("x"), 300))
+	data := append(oggPage([]byte("\x01vorbis identification")),
+		oggPage(append([]byte("\x03vorbis"), vorbisCommentBlock(long, "TITLE=Beep", "ARTIST=Tester")...))...)
+	tags, err := readTags(writeTestFile(t, dir, "beep.ogg", data))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "Beep", tags.Title)
+	checkStr(t, "Tester", tags.Artist)
+
+	data = append(oggPage([]byte("OpusHead")), oggPage(append([]byte("OpusTags"), vorbisCommentBlock("TITLE=Opus Beep")...))...)
+	tags, err = readTags(writeTestFile(t, dir, "beep.opus", data))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "Opus Beep", tags.Title)
+}
+
+func TestSongInfoTags(t *testing.T) {
+	fmt.Println("TestSongInfoTags")
+	dir, err := ioutil.TempDir("", "music_player_tags")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	tagged := writeTestFile(t, dir, "tagged.mp3", id3v2Tag(3, id3v2Frame(3, "TIT2", 0, []byte("Beep"))))
+
+	initTestPlayer(t)
+	player.Lock()
+	player.addFile("test_sounds/beep9.mp3")
+	player.addFile(tagged)
+	player.Unlock()
+	player.readQueueTags()
+
+	// the test sounds have only blank tags
+	info, err := player.getCurrentSongInfo()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if info.Tags != nil {
+		t.Errorf("No tags expected, found %v", *info.Tags)
+	}
+
+	_, queueInfo, err := player.getQueueDetails()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkIntFatal(t, 2, len(queueInfo.Tags))
+	checkStr(t, "", queueInfo.Tags[0].Title)
+	checkStr(t, "Beep", queueInfo.Tags[1].Title)
+
+	player.Lock()
+	player.state.current = 1
+	info, err = player.songInfo()
+	player.Unlock()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if info.Tags == nil {
+		t.Fatalf("Tags expected")
+	}
+	checkStr(t, "Beep", info.Tags.Title)
+}
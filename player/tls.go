@@ -0,0 +1,136 @@
+package player
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// certificateValidity is how long a generated self-signed certificate is valid
+const certificateValidity = 10 * 365 * 24 * time.Hour
+
+// fileExists checks if there is a file at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// loadCertificate loads the certificate and key of the web service
+// If neither file exists a self-signed certificate for localhost and hosts is generated first
+// Returns error if only one of the files exists or they cannot be read
+func loadCertificate(certFile string, keyFile string, hosts []string) (tls.Certificate, error) {
+	if !fileExists(certFile) && !fileExists(keyFile) {
+		fingerprint, err := generateCertificate(certFile, keyFile, hosts)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		fmt.Println("generated self-signed certificate", certFile, "with SHA-256 fingerprint", fingerprint)
+	}
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// generateCertificate writes a self-signed certificate valid for localhost and hosts and its key
+// The key file is readable only by its owner
+// Returns the SHA-256 fingerprint of the certificate that clients can pin
+func generateCertificate(certFile string, keyFile string, hosts []string) (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"music_player"}, CommonName: "music_player"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		// the certificate is its own CA so that clients can trust it with -ca
+		IsCA:        true,
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if len(host) > 0 {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return "", err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	err = writePem(certFile, "CERTIFICATE", der, 0644)
+	if err != nil {
+		return "", err
+	}
+	err = writePem(keyFile, "EC PRIVATE KEY", keyDer, 0600)
+	if err != nil {
+		os.Remove(certFile)
+		return "", err
+	}
+	return certificateFingerprint(der), nil
+}
+
+// writePem writes a single pem block to a new file
+func writePem(path string, blockType string, bytes []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	err = pem.Encode(file, &pem.Block{Type: blockType, Bytes: bytes})
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// certificateFingerprint returns the hex encoded SHA-256 hash of a DER encoded certificate
+func certificateFingerprint(der []byte) string {
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:])
+}
+
+// tlsConfig creates the TLS settings of the web service from the configured certificate
+// Returns nil if TLS is disabled
+func tlsConfig(config Config) (*tls.Config, error) {
+	if !config.TLS {
+		return nil, nil
+	}
+	certificate, err := loadCertificate(config.CertFile, config.KeyFile, []string{config.Address})
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
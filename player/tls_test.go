@@ -0,0 +1,65 @@
+package player
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCertificateGenerates(t *testing.T) {
+	fmt.Println("TestLoadCertificateGenerates")
+	dir, err := ioutil.TempDir("", "music_player_tls")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	certificate, err := loadCertificate(certFile, keyFile, []string{"192.168.1.10", "music.local"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "192.168.1.10", "music.local"} {
+		if leaf.VerifyHostname(host) != nil {
+			t.Errorf("Expected the certificate to be valid for %s", host)
+		}
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if keyInfo.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key to be readable only by its owner, found %v", keyInfo.Mode().Perm())
+	}
+
+	// the generated pair is reused
+	again, err := loadCertificate(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, certificateFingerprint(certificate.Certificate[0]), certificateFingerprint(again.Certificate[0]))
+}
+
+func TestValidateTLS(t *testing.T) {
+	fmt.Println("TestValidateTLS")
+	config := DefaultConfig()
+	config.Output = "null"
+	config.TLS = true
+	config.CertFile = "test_sounds/beep9.mp3"
+	config.KeyFile = "no_such_key.pem"
+	if config.Validate() == nil {
+		t.Errorf("Error expected")
+	}
+	config.CertFile = ""
+	if config.Validate() == nil {
+		t.Errorf("Error expected")
+	}
+}
@@ -0,0 +1,130 @@
+package player
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// VolumeInfo describes the volume of the player
+type VolumeInfo struct {
+	// Volume in percent (0 - 100)
+	Percent float64
+	// Volume in dB (0 for 100%). nil for 0% as it has no dB value
+	Decibels *float64 `json:"Decibels,omitempty"`
+	// True if the player is muted. Percent keeps the volume to be restored on unmute
+	Muted bool
+}
+
+// maxVolume is the volume at which songs are played unchanged
+const maxVolume = 100
+
+// percentToDecibels converts volume in percent to dB
+func percentToDecibels(percent float64) float64 {
+	return 20 * math.Log10(percent/maxVolume)
+}
+
+// decibelsToPercent converts volume in dB to percent
+func decibelsToPercent(decibels float64) float64 {
+	return maxVolume * math.Pow(10, decibels/20)
+}
+
+// parseVolume parses volume given in percent ("50", "50%") or in dB ("-6dB")
+// Returns the volume in percent or error if the volume is out of 0 - 100% range
+func parseVolume(level string) (float64, error) {
+	level = strings.TrimSpace(level)
+	lower := strings.ToLower(level)
+	isDecibels := strings.HasSuffix(lower, "db")
+	if isDecibels {
+		level = strings.TrimSpace(level[:len(level)-2])
+	} else {
+		level = strings.TrimSuffix(level, "%")
+	}
+
+	value, err := strconv.ParseFloat(level, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 1) {
+		return 0, errors.New(invalid_volume_msg)
+	}
+	if isDecibels {
+		value = decibelsToPercent(value)
+	}
+	if value < 0 || value > maxVolume {
+		return 0, errors.New(invalid_volume_msg)
+	}
+	return value, nil
+}
+
+// volumeInfo returns the info about the volume
+func (player *musicPlayer) volumeInfo() VolumeInfo {
+	// Warning: never call this if the player is not locked
+	info := VolumeInfo{Percent: player.state.volume, Muted: player.state.muted}
+	if info.Percent > 0 {
+		decibels := percentToDecibels(info.Percent)
+		info.Decibels = &decibels
+	}
+	return info
+}
+
+// gain returns the amplitude ratio songs are played with
+func (player *musicPlayer) gain() float64 {
+	// Warning: never call this if the player is not locked
+	if player.state.muted {
+		return 0
+	}
+	return player.state.volume / maxVolume
+}
+
+// getVolume gets the volume of the player
+func (player *musicPlayer) getVolume() VolumeInfo {
+	player.Lock()
+	defer player.Unlock()
+	return player.volumeInfo()
+}
+
+// setVolume sets the volume of the player in percent ("50", "50%") or dB ("-6dB") and unmutes it
+// The volume is kept for all songs that follow
+// Returns the new volume or error if the volume is invalid
+func (player *musicPlayer) setVolume(level string) (VolumeInfo, error) {
+	percent, err := parseVolume(level)
+	if err != nil {
+		return player.getVolume(), err
+	}
+	return player.changeVolume(percent, false)
+}
+
+// mute mutes the player keeping the volume for unmute
+func (player *musicPlayer) mute() (VolumeInfo, error) {
+	player.Lock()
+	percent := player.state.volume
+	player.Unlock()
+	return player.changeVolume(percent, true)
+}
+
+// unmute restores the volume before mute
+func (player *musicPlayer) unmute() (VolumeInfo, error) {
+	player.Lock()
+	percent := player.state.volume
+	player.Unlock()
+	return player.changeVolume(percent, false)
+}
+
+// changeVolume changes the volume and the mute state
+// The chain of the playing song is rebuilt so that the change is heard immediately
+func (player *musicPlayer) changeVolume(percent float64, muted bool) (VolumeInfo, error) {
+	player.Lock()
+	changed := percent != player.state.volume || muted != player.state.muted
+	player.state.volume = percent
+	player.state.muted = muted
+	player.stateChanged()
+	info := player.volumeInfo()
+	if !changed || player.state.status != playing {
+		player.Unlock()
+		return info, nil
+	}
+
+	player.stopFlow()
+	position := player.state.durationPaused.Seconds()
+	player.Unlock()
+	return info, player.playFrom(position)
+}
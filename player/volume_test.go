@@ -0,0 +1,76 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func checkFloat(t *testing.T, expected float64, found float64) {
+	if math.Abs(found-expected) > 0.01 {
+		t.Errorf("Expected\n---\n%f\n---\nbut found\n---\n%f\n---\n", expected, found)
+	}
+}
+
+func TestParseVolume(t *testing.T) {
+	fmt.Println("TestParseVolume")
+	levels := map[string]float64{
+		"0":     0,
+		"50":    50,
+		"75.5%": 75.5,
+		"100":   100,
+		"0dB":   100,
+		"-6dB":  50.12,
+		"-20db": 10,
+	}
+	for level, expected := range levels {
+		found, err := parseVolume(level)
+		if err != nil {
+			t.Errorf("Unexpected error for %s - %s", level, err.Error())
+			continue
+		}
+		checkFloat(t, expected, found)
+	}
+}
+
+func TestParseVolumeInvalid(t *testing.T) {
+	fmt.Println("TestParseVolumeInvalid")
+	for _, level := range []string{"", "abc", "-1", "101", "3dB", "NaN", "Inf%"} {
+		_, err := parseVolume(level)
+		if err == nil {
+			t.Errorf("Expected error for %s", level)
+			continue
+		}
+		checkStr(t, invalid_volume_msg, err.Error())
+	}
+}
+
+func TestMuteUnmute(t *testing.T) {
+	fmt.Println("TestMuteUnmute")
+	initTestPlayer(t)
+	defer player.waitEnd()
+	player.setVolume("40")
+	info, _ := player.mute()
+	checkFloat(t, 40, info.Percent)
+	checkFloat(t, 0, player.gain())
+	if !info.Muted {
+		t.Errorf("Expected the player to be muted")
+	}
+	info, _ = player.unmute()
+	checkFloat(t, 40, info.Percent)
+	checkFloat(t, 0.4, player.gain())
+	checkFloat(t, -7.96, *info.Decibels)
+	if info.Muted {
+		t.Errorf("Expected the player NOT to be muted")
+	}
+}
+
+func TestVolumeAfterStop(t *testing.T) {
+	fmt.Println("TestVolumeAfterStop")
+	initTestPlayer(t)
+	defer player.waitEnd()
+	player.play("test_sounds/beep9.mp3")
+	player.setVolume("-6dB")
+	player.stop()
+	checkFloat(t, 50.12, player.getVolume().Percent)
+}
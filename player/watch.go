@@ -0,0 +1,166 @@
+package player
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchDelay is how long changes are collected before the library is refreshed,
+// so that copying an album refreshes it once
+const watchDelay = 2 * time.Second
+
+// notifier reports that files or directories in the music roots changed
+// It is implemented with inotify on linux
+type notifier interface {
+	changes() <-chan struct{}
+	close()
+}
+
+// libraryWatcher keeps the library and the queue in sync with the music roots
+type libraryWatcher struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// watchLibrary starts watching the music roots for changes
+// The roots are scanned every poll interval too, as network file systems e.g. NFS or SMB
+// do not report the changes made by other machines
+func (player *musicPlayer) watchLibrary(poll time.Duration) *libraryWatcher {
+	player.Lock()
+	roots := append([]string{}, player.musicRoots...)
+	player.Unlock()
+	changes, err := newNotifier(roots)
+	if err != nil {
+		fmt.Println("cannot watch the music roots, polling them only ", err.Error())
+		return player.startLibraryWatcher(nil, poll)
+	}
+	return player.startLibraryWatcher(changes, poll)
+}
+
+// startLibraryWatcher refreshes the library after the notifier reports changes
+// and every poll interval. The notifier may be nil
+func (player *musicPlayer) startLibraryWatcher(changes notifier, poll time.Duration) *libraryWatcher {
+	watcher := &libraryWatcher{stop: make(chan struct{}), done: make(chan struct{})}
+	var changed <-chan struct{}
+	if changes != nil {
+		changed = changes.changes()
+	}
+	ticker := time.NewTicker(poll)
+
+	go func() {
+		defer close(watcher.done)
+		var delay <-chan time.Time
+		for {
+			select {
+			case <-changed:
+				// wait until the changes are over
+				delay = time.After(watchDelay)
+			case <-delay:
+				delay = nil
+				if !player.refreshLibrary() {
+					// a scan is running and may have missed the changes
+					delay = time.After(watchDelay)
+				}
+			case <-ticker.C:
+				player.refreshLibrary()
+			case <-watcher.stop:
+				if changes != nil {
+					changes.close()
+				}
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return watcher
+}
+
+// close stops watching the music roots
+func (watcher *libraryWatcher) close() {
+	close(watcher.stop)
+	<-watcher.done
+}
+
+// refreshLibrary scans the music roots for changes and brings the queue in sync with them
+// Returns false if a scan is already running
+func (player *musicPlayer) refreshLibrary() bool {
+	player.Lock()
+	roots := append([]string{}, player.musicRoots...)
+	player.Unlock()
+	known, err := player.library.startScan()
+	if err != nil {
+		return false
+	}
+	stats, changed := player.library.scan(roots, known, false)
+	if len(changed) > 0 {
+		player.publish(Event{Type: eventLibrary, Info: stats})
+	}
+	player.syncQueue(changed)
+	return true
+}
+
+// syncQueue forgets the tags of the changed files and removes the songs that no longer exist from the queue
+// The tags of the changed songs are read again after that
+// The current song is kept while it is playing and removed when it ends
+func (player *musicPlayer) syncQueue(changed []string) {
+	// runs after the player is unlocked
+	defer player.readQueueTags()
+	player.Lock()
+	defer player.Unlock()
+	for _, path := range changed {
+		delete(player.tags, path)
+	}
+
+	missing := make([]string, 0)
+	for i := len(player.state.queue) - 1; i >= 0; i-- {
+		song := player.state.queue[i]
+		if _, err := os.Stat(song); !os.IsNotExist(err) {
+			continue
+		}
+		if i == player.state.current && player.state.status == playing {
+			// the song is already open, it is reported now and removed when it ends
+			if player.state.gone != song {
+				player.state.gone = song
+				missing = append([]string{song}, missing...)
+			}
+			continue
+		}
+		if i == player.state.current {
+			// a paused song cannot be resumed - the following song waits to be played
+			player.state.status = waiting
+			player.state.durationPaused = 0
+			player.resetSignal()
+		}
+		player.removeFromQueue(i)
+		missing = append([]string{song}, missing...)
+	}
+	if len(missing) == 0 {
+		return
+	}
+	if player.state.current >= len(player.state.queue) {
+		player.state.current = 0
+	}
+	player.publish(Event{Type: eventMissing, Data: missing})
+	player.stateChanged()
+}
+
+// removeGone removes the song that was deleted while it played from the queue after its chain ended
+// A paused song cannot be resumed - the following song waits to be played
+func (player *musicPlayer) removeGone() {
+	// Warning: never call this if the player is not locked
+	gone := player.state.gone
+	player.state.gone = ""
+	for i, song := range player.state.queue {
+		if song != gone {
+			continue
+		}
+		if i == player.state.current && player.state.status == paused {
+			player.state.status = waiting
+			player.state.durationPaused = 0
+			player.resetSignal()
+		}
+		player.removeFromQueue(i)
+		return
+	}
+}
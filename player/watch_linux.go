@@ -0,0 +1,135 @@
+//go:build linux
+// +build linux
+
+package player
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask are the changes of a directory that are watched - files and directories
+// are created, written, deleted or moved and the directory itself is deleted or moved
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotifyNotifier watches every directory of the music roots with inotify
+// New directories are watched as they are created
+type inotifyNotifier struct {
+	sync.Mutex
+	file    *os.File
+	fd      int
+	dirs    map[int32]string
+	changed chan struct{}
+	done    chan struct{}
+}
+
+// newNotifier starts watching the roots and all directories in them
+// Returns error if inotify is not available or the watch limit is reached
+func newNotifier(roots []string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	watcher := &inotifyNotifier{
+		// a non-blocking file is read through the runtime poller, so that close ends the read
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		dirs:    make(map[int32]string),
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for _, root := range roots {
+		if err := watcher.watchTree(root); err != nil {
+			watcher.file.Close()
+			return nil, err
+		}
+	}
+	go watcher.read()
+	return watcher, nil
+}
+
+// watchTree watches a directory and all directories in it
+func (watcher *inotifyNotifier) watchTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			// unreadable directories are not watched
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(watcher.fd, path, inotifyMask)
+		if err != nil {
+			return err
+		}
+		watcher.Lock()
+		watcher.dirs[int32(wd)] = path
+		watcher.Unlock()
+		return nil
+	})
+}
+
+// read reads the inotify events until the notifier is closed and reports them as changes
+func (watcher *inotifyNotifier) read() {
+	defer close(watcher.done)
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := watcher.file.Read(buffer)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			if nameEnd > n {
+				break
+			}
+			watcher.handle(event, buffer[nameStart:nameEnd])
+			offset = nameEnd
+		}
+		select {
+		case watcher.changed <- struct{}{}:
+		default:
+			// a change is already reported
+		}
+	}
+}
+
+// handle watches the directories that are created or moved into the roots
+// and forgets the ones that are gone
+func (watcher *inotifyNotifier) handle(event *syscall.InotifyEvent, name []byte) {
+	if event.Mask&syscall.IN_IGNORED != 0 {
+		watcher.Lock()
+		delete(watcher.dirs, event.Wd)
+		watcher.Unlock()
+		return
+	}
+	if event.Mask&syscall.IN_ISDIR == 0 || event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 {
+		return
+	}
+	watcher.Lock()
+	dir, ok := watcher.dirs[event.Wd]
+	watcher.Unlock()
+	if !ok {
+		return
+	}
+	for i, b := range name {
+		if b == 0 {
+			name = name[:i]
+			break
+		}
+	}
+	// files created before the watch are found by the scan that follows the change
+	watcher.watchTree(filepath.Join(dir, string(name)))
+}
+
+func (watcher *inotifyNotifier) changes() <-chan struct{} {
+	return watcher.changed
+}
+
+func (watcher *inotifyNotifier) close() {
+	watcher.file.Close()
+	<-watcher.done
+}
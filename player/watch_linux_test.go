@@ -0,0 +1,44 @@
+package player
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func checkChange(t *testing.T, changes notifier) {
+	select {
+	case <-changes.changes():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a change")
+	}
+}
+
+func TestInotifyNotifier(t *testing.T) {
+	fmt.Println("TestInotifyNotifier")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	changes, err := newNotifier([]string{dir})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer changes.close()
+
+	writeTestFile(t, dir, "Tester/Beeps/02.mp3", make([]byte, 32))
+	checkChange(t, changes)
+
+	// new directories are watched as well
+	err = os.Mkdir(filepath.Join(dir, "New"), 0777)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkChange(t, changes)
+	time.Sleep(10 * time.Millisecond)
+	writeTestFile(t, dir, "New/01.mp3", make([]byte, 32))
+	checkChange(t, changes)
+
+	os.Rename(filepath.Join(dir, "untagged.mp3"), filepath.Join(dir, "New/02.mp3"))
+	checkChange(t, changes)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package player
+
+import "errors"
+
+// newNotifier reports that the changes cannot be watched, so the music roots are polled
+func newNotifier(roots []string) (notifier, error) {
+	return nil, errors.New("file system notifications are only supported on linux")
+}
@@ -0,0 +1,131 @@
+package player
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncQueue(t *testing.T) {
+	fmt.Println("TestSyncQueue")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	tagged := filepath.Join(dir, "Tester/Beeps/01.mp3")
+	untagged := filepath.Join(dir, "untagged.mp3")
+	gone := filepath.Join(dir, "gone.mp3")
+	initTestPlayer(t, dir)
+	events := player.subscribe()
+	defer player.unsubscribe(events)
+
+	player.Lock()
+	player.state.queue = []string{tagged, gone, untagged, gone}
+	player.state.current = 1
+	player.state.status = paused
+	player.tags[tagged] = Tags{Title: "Stale"}
+	player.tags[gone] = Tags{Title: "Gone"}
+	player.Unlock()
+
+	player.syncQueue([]string{tagged})
+	player.Lock()
+	defer player.Unlock()
+	checkQueue(t, []string{tagged, untagged})
+	// the paused song is gone, the following one waits to be played
+	checkInt(t, 1, player.state.current)
+	checkInt(t, waiting, player.state.status)
+	// the tags of the changed file are read again
+	checkStr(t, "Beep", player.songTags(tagged).Title)
+	// the tags of the removed songs are forgotten
+	if _, ok := player.tags[gone]; ok {
+		t.Errorf("Expected the tags of the removed song to be forgotten")
+	}
+	event := checkEvent(t, events, eventMissing)
+	checkNames(t, []string{"gone.mp3", "gone.mp3"}, event.Data)
+	checkEvent(t, events, eventQueue)
+}
+
+func TestSyncQueuePlaying(t *testing.T) {
+	fmt.Println("TestSyncQueuePlaying")
+	initTestPlayer(t)
+	player.Lock()
+	player.state.queue = []string{"gone.mp3", "test_sounds/beep9.mp3"}
+	player.state.status = playing
+	player.Unlock()
+
+	events := player.subscribe()
+	defer player.unsubscribe(events)
+
+	player.syncQueue(nil)
+	// the playing song is reported at once but kept until it ends
+	event := checkEvent(t, events, eventMissing)
+	checkNames(t, []string{"gone.mp3"}, event.Data)
+	checkEvent(t, events, eventQueue)
+	player.syncQueue(nil)
+	checkNoEvent(t, events)
+	player.Lock()
+	defer player.Unlock()
+	checkQueue(t, []string{"gone.mp3", "test_sounds/beep9.mp3"})
+
+	// the song is paused and then its chain ends
+	player.state.status = paused
+	player.removeGone()
+	checkQueue(t, []string{"test_sounds/beep9.mp3"})
+	checkInt(t, 0, player.state.current)
+	checkInt(t, waiting, player.state.status)
+	checkStr(t, "", player.state.gone)
+}
+
+func TestPollLibrary(t *testing.T) {
+	fmt.Println("TestPollLibrary")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	initTestPlayer(t, dir)
+	watcher := player.startLibraryWatcher(nil, 10*time.Millisecond)
+	defer watcher.close()
+
+	for i := 0; i < 200 && player.getLibraryStats().Tracks != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkInt(t, 2, player.getLibraryStats().Tracks)
+
+	os.Remove(filepath.Join(dir, "untagged.mp3"))
+	for i := 0; i < 200 && player.getLibraryStats().Tracks != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkInt(t, 1, player.getLibraryStats().Tracks)
+}
+
+// silentNotifier never reports changes like inotify on a network file system
+type silentNotifier struct {
+	closed chan struct{}
+}
+
+func (notifier silentNotifier) changes() <-chan struct{} {
+	return nil
+}
+
+func (notifier silentNotifier) close() {
+	close(notifier.closed)
+}
+
+func TestPollLibraryWithNotifier(t *testing.T) {
+	fmt.Println("TestPollLibraryWithNotifier")
+	dir := initLibraryDir(t)
+	defer os.RemoveAll(dir)
+	initTestPlayer(t, dir)
+	notifier := silentNotifier{closed: make(chan struct{})}
+	watcher := player.startLibraryWatcher(notifier, 10*time.Millisecond)
+
+	// the roots are scanned although the notifier reports nothing
+	for i := 0; i < 200 && player.getLibraryStats().Tracks != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkInt(t, 2, player.getLibraryStats().Tracks)
+	watcher.close()
+	select {
+	case <-notifier.closed:
+	default:
+		t.Errorf("Expected the notifier to be closed")
+	}
+}
@@ -0,0 +1,222 @@
+package player
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// wsRoute is the REST route a websocket action is performed with
+// The path has a %s for every argument of the action
+type wsRoute struct {
+	method string
+	path   string
+}
+
+// wsRoutes maps the websocket actions to the REST routes, so that both share the same handlers
+// and the same roles are needed for them
+var wsRoutes = map[string]wsRoute{
+	"play":      {"PUT", "/play/%s"},
+	"pause":     {"POST", "/pause"},
+	"resume":    {"POST", "/resume"},
+	"stop":      {"PUT", "/stop"},
+	"next":      {"POST", "/next"},
+	"previous":  {"POST", "/previous"},
+	"songinfo":  {"GET", "/songinfo"},
+	"add":       {"POST", "/add/%s"},
+	"save":      {"PUT", "/save/%s"},
+	"playlists": {"GET", "/playlists"},
+	"queueinfo": {"GET", "/queueinfo"},
+	"jump":      {"POST", "/jump/%s"},
+	"seek":      {"POST", "/seek/%s"},
+	"volume":    {"GET", "/volume"},
+	"setvolume": {"PUT", "/volume/%s"},
+	"mute":      {"PUT", "/volume/mute"},
+	"unmute":    {"PUT", "/volume/unmute"},
+	"mode":      {"GET", "/mode"},
+	"repeat":    {"PUT", "/mode/repeat/%s"},
+	"shuffle":   {"PUT", "/mode/shuffle/%s"},
+	"crossfade": {"PUT", "/crossfade/%s"},
+	"remove":    {"DELETE", "/queue/%s"},
+	"move":      {"POST", "/queue/move/%s/%s"},
+	"playnext":  {"POST", "/playnext/%s"},
+	"clear":     {"DELETE", "/queue"},
+	"rescan":    {"POST", "/library/rescan"},
+	"library":   {"GET", "/library/stats"},
+	"artists":   {"GET", "/library/artists"},
+	"albums":    {"GET", "/library/artists/%s/albums"},
+	"tracks":    {"GET", "/library/albums/%s/tracks"},
+	"genres":    {"GET", "/library/genres"},
+	"search":    {"GET", "/search?q=%s"},
+
+	"playlist":       {"GET", "/playlists/%s"},
+	"deleteplaylist": {"DELETE", "/playlists/%s"},
+	"renameplaylist": {"POST", "/playlists/%s/rename?to=%s"},
+	"playlistadd":    {"POST", "/playlists/%s/add/%s"},
+	"playlistremove": {"DELETE", "/playlists/%s/%s"},
+	"playlistmove":   {"POST", "/playlists/%s/move/%s/%s"},
+}
+
+// wsCommand is a command sent by a websocket client e.g. {"Id": "1", "Action": "play", "Args": ["beep9.mp3"]}
+// Id is optional and is sent back with the response
+type wsCommand struct {
+	Id     string
+	Action string
+	Args   []string
+}
+
+// wsResponse is the response to a websocket command - the response of the REST route with the id and the action
+type wsResponse struct {
+	Id     string `json:"Id,omitempty"`
+	Action string
+	ResponseContainer
+}
+
+// recordedResponse keeps the body a handler writes so that it can be sent over the websocket
+// The status is not needed as the body has the code of the response
+type recordedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (response *recordedResponse) Header() http.Header {
+	return response.header
+}
+
+func (response *recordedResponse) Write(data []byte) (int, error) {
+	return response.body.Write(data)
+}
+
+func (response *recordedResponse) WriteHeader(status int) {}
+
+// commandRequest creates the REST request that performs a websocket command
+// The token the websocket was opened with is sent with it
+// Returns error if the action is unknown or the number of arguments is wrong
+func commandRequest(command wsCommand, token string) (*http.Request, error) {
+	route, ok := wsRoutes[command.Action]
+	if !ok {
+		return nil, errors.New(unknown_action_msg)
+	}
+	// the arguments after the ? are query parameters
+	pathArgs := strings.Count(strings.SplitN(route.path, "?", 2)[0], "%s")
+	args := make([]interface{}, 0, len(command.Args))
+	for i, arg := range command.Args {
+		if i < pathArgs {
+			args = append(args, url.PathEscape(arg))
+		} else {
+			args = append(args, url.QueryEscape(arg))
+		}
+	}
+	path := fmt.Sprintf(route.path, args...)
+	if strings.Contains(path, "%!") {
+		// too few or too many arguments
+		return nil, errors.New(invalid_arguments_msg)
+	}
+	request, err := http.NewRequest(route.method, path, nil)
+	if err != nil {
+		return nil, errors.New(invalid_arguments_msg)
+	}
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return request, nil
+}
+
+// performCommand performs a websocket command with the REST handlers
+// Returns the response of the handler or an error response if the command is invalid
+func performCommand(handler http.Handler, command wsCommand, token string) wsResponse {
+	response := wsResponse{Id: command.Id, Action: command.Action}
+	request, err := commandRequest(command, token)
+	if err != nil {
+		response.ResponseContainer = getResponseContainer(nil, err)
+		return response
+	}
+
+	recorded := &recordedResponse{header: make(http.Header)}
+	handler.ServeHTTP(recorded, request)
+	if json.Unmarshal(recorded.body.Bytes(), &response.ResponseContainer) != nil {
+		// not a response of the player e.g. a path that no route matches
+		response.ResponseContainer = getResponseContainer(nil, errors.New(invalid_arguments_msg))
+	}
+	return response
+}
+
+// websocketHandler creates the handler of the websocket control channel
+// Every command is performed with the REST handlers of the mux and its response is sent back.
+// The events of the player are pushed as they happen
+func websocketHandler(mux http.Handler) http.Handler {
+	return websocket.Server{
+		Handshake: checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			serveWebsocket(ws, mux)
+		},
+	}
+}
+
+// checkOrigin rejects websockets opened by pages of other sites, so that they cannot control the player
+// through the browser of a user. Clients that present a token are authenticated with it instead
+// and clients that are not browsers send no origin
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	if len(player.tokens) > 0 && len(requestToken(r)) > 0 {
+		return nil
+	}
+	if config.Origin == nil || config.Origin.Host == r.Host {
+		return nil
+	}
+	return fmt.Errorf("websocket origin %s does not match host %s", config.Origin.Host, r.Host)
+}
+
+// serveWebsocket reads commands and sends responses and events until the connection is closed
+// or the service shuts down
+func serveWebsocket(ws *websocket.Conn, mux http.Handler) {
+	defer ws.Close()
+	token := requestToken(ws.Request())
+	var writeMutex sync.Mutex
+	send := func(message interface{}) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return websocket.JSON.Send(ws, message)
+	}
+
+	events := player.subscribe()
+	defer player.unsubscribe(events)
+	go func() {
+		for event := range events {
+			if send(event) != nil {
+				break
+			}
+		}
+		// the service is shutting down or the client went away
+		ws.Close()
+	}()
+
+	for {
+		command := wsCommand{}
+		err := websocket.JSON.Receive(ws, &command)
+		if err != nil {
+			if isJsonError(err) {
+				send(wsResponse{ResponseContainer: getResponseContainer(nil, errors.New(invalid_command_msg))})
+				continue
+			}
+			return
+		}
+		if send(performCommand(mux, command, token)) != nil {
+			return
+		}
+	}
+}
+
+// isJsonError checks if a message could not be received because it is not a valid command
+func isJsonError(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package player
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestCommandRequest(t *testing.T) {
+	fmt.Println("TestCommandRequest")
+	request, err := commandRequest(wsCommand{Action: "move", Args: []string{"2", "0"}}, "s3cret")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "POST", request.Method)
+	checkStr(t, "/queue/move/2/0", request.URL.Path)
+	checkStr(t, "Bearer s3cret", request.Header.Get("Authorization"))
+
+	request, err = commandRequest(wsCommand{Action: "play", Args: []string{"test_sounds/beep 9.mp3"}}, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "/play/test_sounds%2Fbeep%209.mp3", request.URL.EscapedPath())
+	checkStr(t, "", request.Header.Get("Authorization"))
+
+	request, err = commandRequest(wsCommand{Action: "renameplaylist", Args: []string{"a b.m3u", "rock & roll+.pls"}}, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "/playlists/a%20b.m3u/rename", request.URL.EscapedPath())
+	checkStr(t, "rock & roll+.pls", request.URL.Query().Get("to"))
+
+	request, err = commandRequest(wsCommand{Action: "crossfade", Args: []string{"5"}}, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "PUT", request.Method)
+	checkStr(t, "/crossfade/5", request.URL.Path)
+
+	request, err = commandRequest(wsCommand{Action: "search", Args: []string{`beep artist:"the testers"`}}, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkStr(t, "GET", request.Method)
+	checkStr(t, "/search", request.URL.Path)
+	checkStr(t, `beep artist:"the testers"`, request.URL.Query().Get("q"))
+}
+
+func TestCommandRequestInvalid(t *testing.T) {
+	fmt.Println("TestCommandRequestInvalid")
+	_, err := commandRequest(wsCommand{Action: "dance"}, "")
+	if err == nil || err.Error() != unknown_action_msg {
+		t.Errorf("Expected %s", unknown_action_msg)
+	}
+	_, err = commandRequest(wsCommand{Action: "play"}, "")
+	if err == nil || err.Error() != invalid_arguments_msg {
+		t.Errorf("Expected %s", invalid_arguments_msg)
+	}
+	_, err = commandRequest(wsCommand{Action: "pause", Args: []string{"now"}}, "")
+	if err == nil || err.Error() != invalid_arguments_msg {
+		t.Errorf("Expected %s", invalid_arguments_msg)
+	}
+}
+
+func TestPerformCommand(t *testing.T) {
+	fmt.Println("TestPerformCommand")
+	initTestPlayer(t)
+	player.setTokens(map[string]string{"ro": "readonly"})
+	handler := player.authenticate(http.HandlerFunc(getModes))
+
+	response := performCommand(handler, wsCommand{Id: "7", Action: "mode"}, "ro")
+	checkStr(t, "7", response.Id)
+	checkInt(t, success, response.Code)
+	checkStr(t, modes_info, response.Message)
+
+	response = performCommand(handler, wsCommand{Id: "8", Action: "next"}, "ro")
+	checkInt(t, failure, response.Code)
+	checkStr(t, forbidden_msg, response.Message)
+
+	response = performCommand(handler, wsCommand{Action: "dance"}, "ro")
+	checkStr(t, unknown_action_msg, response.Message)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	fmt.Println("TestCheckOrigin")
+	initTestPlayer(t)
+	request, _ := http.NewRequest("GET", "http://localhost:8765/ws", nil)
+	same, _ := url.Parse("http://localhost:8765")
+	other, _ := url.Parse("http://example.com")
+
+	if checkOrigin(&websocket.Config{Origin: same}, request) != nil {
+		t.Errorf("Expected the page of the player to be allowed")
+	}
+	if checkOrigin(&websocket.Config{}, request) != nil {
+		t.Errorf("Expected a client without origin to be allowed")
+	}
+	if checkOrigin(&websocket.Config{Origin: other}, request) == nil {
+		t.Errorf("Expected a page of another site to be rejected")
+	}
+
+	// the token is checked instead of the origin
+	player.setTokens(map[string]string{"ro": "readonly"})
+	request, _ = http.NewRequest("GET", "http://localhost:8765/ws?token=ro", nil)
+	if checkOrigin(&websocket.Config{Origin: other}, request) != nil {
+		t.Errorf("Expected a client with a token to be allowed")
+	}
+}
@@ -124,9 +124,19 @@ function sendToPlayer(method, action, afterFunction, cb) {
         afterFunction && afterFunction(xhttp, getElementId(action), cb);
     };
     xhttp.open(method, action.concat(name), true);
+    var token = getToken();
+    if (token) {
+        xhttp.setRequestHeader("Authorization", "Bearer " + token);
+    }
     xhttp.send();
 }
 
+// getToken returns the token the page was opened with e.g. /secret?token=abc
+function getToken() {
+    var match = /[?&]token=([^&]*)/.exec(window.location.search);
+    return match ? decodeURIComponent(match[1]) : "";
+}
+
 function isNameApplicable(action) {
     return action == "play/" || action == "add/" || action == "save/";
 }
@@ -147,16 +157,26 @@ function updateContentImpl(elementId, responseText) {
     var prefix = isSongs ? "s" : (isPlaylists ? "p" : "");
 
     if (res["Code"] > 0) {
-        content = res["Message"];
+        content = escapeHtml(res["Message"]);
     } else if (isSongs || isPlaylists) {
         var items = res["Data"];
+        var tags = (res["Info"] && res["Info"]["Tags"]) || [];
         if (typeof items != "undefined") {
             for (var i = 0; i < items.length; i++) {
-                content = content + "<div><a href='#' id='" + prefix + i + "'>" + items[i] + "</a></div>"
+                content = content + "<div><a href='#' id='" + prefix + i + "'>" + songTitle(items[i], tags[i]) +
+                    "</a></div>"
             }
         }
     } else {
         content = res["Data"];
+        var info = res["Info"];
+        if (typeof info != "undefined") {
+            content = songTitle(content, info["Tags"]);
+            content = content + " (" + info["Status"] + " " + formatSeconds(info["Elapsed"]) + " / " +
+                formatSeconds(info["Duration"]) + ")";
+        } else if (typeof content != "undefined") {
+            content = escapeHtml(content);
+        }
     }
 
     // update response
@@ -181,6 +201,27 @@ function updateContentImpl(elementId, responseText) {
     }
 }
 
+// songTitle names a song by its artist and title if it has tags, otherwise by its file name
+// The title is escaped as the tags and names come from the files
+function songTitle(name, tags) {
+    if (!tags || !tags["Title"]) {
+        return escapeHtml(name);
+    }
+    return escapeHtml(tags["Artist"] ? tags["Artist"] + " - " + tags["Title"] : tags["Title"]);
+}
+
+// escapeHtml makes text safe to be put in innerHTML
+function escapeHtml(text) {
+    return String(text).replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;")
+        .replace(/"/g, "&quot;").replace(/'/g, "&#39;");
+}
+
+function formatSeconds(seconds) {
+    var total = Math.floor(seconds);
+    var rest = total % 60;
+    return Math.floor(total / 60) + ":" + (rest < 10 ? "0" : "") + rest;
+}
+
 function getElementId(action) {
     if (action == "queueinfo") {
         return "queue";
@@ -195,9 +236,26 @@ function getElementId(action) {
     }
 }
 
+// listenToEvents updates the page when the player changes. Falls back to polling without EventSource
+function listenToEvents() {
+    if (typeof EventSource == "undefined") {
+        currentSongPeriodic();
+        return;
+    }
+    var token = getToken();
+    var events = new EventSource("events" + (token ? "?token=" + encodeURIComponent(token) : ""));
+    events.addEventListener("playing", currentSong);
+    events.addEventListener("paused", currentSong);
+    events.addEventListener("stopped", function() {
+        currentSong();
+        queueInfo();
+    });
+    events.addEventListener("queue", queueInfo);
+}
+
 document.addEventListener('DOMContentLoaded', function() {
    init();
-   currentSongPeriodic();
+   listenToEvents();
    getPlaylists();
    queueInfo();
 }, false);
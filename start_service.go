@@ -1,8 +1,78 @@
 package main
 
 import "github.com/katya-spasova/music_player/player"
+import (
+	"flag"
+	"fmt"
+	"os"
+)
 
 // main is endpoint for music_player web service
 func main() {
-	player.Start()
+	configFile := flag.String("config", player.ConfigFile(),
+		"Json config file. Settings in it are overridden by MUSIC_PLAYER_* environment variables and flags")
+	address := flag.String("address", "", "Address to bind to. Empty for all interfaces")
+	port := flag.Int("port", 0, "Port to listen on (default 8765)")
+	mpdPort := flag.Int("mpd-port", 0, "Port to listen on for MPD clients e.g. 6600 (default disabled)")
+	playlists := flag.String("playlists", "", "Directory where the playlists are saved")
+	roots := flag.String("roots", "", "Directories music can be played from, separated like PATH")
+	output := flag.String("output", "",
+		"Output sink. Use one of: auto/null/alsa[:device]/pulseaudio[:device]/coreaudio[:device]/waveaudio[:device]/wav:path/flac:path (default auto)")
+	state := flag.String("state", "",
+		"File the player state is saved to and restored from. Set it empty to disable (default music_player_state.json)")
+	library := flag.String("library", "",
+		"File the library index is saved to. Set it empty to disable (default music_player_library.json)")
+	poll := flag.Int("poll", 0,
+		"Seconds between scans of the music roots, that find changes on network file systems (default 300)")
+	useTLS := flag.Bool("tls", false, "Serve HTTPS. A self-signed certificate is generated if there is none")
+	cert := flag.String("cert", "", "PEM certificate file for HTTPS (default music_player_cert.pem)")
+	key := flag.String("key", "", "PEM key file for HTTPS (default music_player_key.pem)")
+	flag.Parse()
+
+	config, err := player.LoadConfig(*configFile)
+	if err == nil {
+		err = config.ApplyEnv()
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
+
+	// only the flags that are set override the config
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "address":
+			config.Address = *address
+		case "port":
+			config.Port = *port
+		case "mpd-port":
+			config.MPDPort = *mpdPort
+		case "playlists":
+			config.PlaylistsDir = *playlists
+		case "roots":
+			config.MusicRoots = player.SplitMusicRoots(*roots)
+		case "output":
+			config.Output = *output
+		case "state":
+			config.StateFile = *state
+		case "library":
+			config.LibraryFile = *library
+		case "poll":
+			config.LibraryPollInterval = *poll
+		case "tls":
+			config.TLS = *useTLS
+		case "cert":
+			config.CertFile = *cert
+		case "key":
+			config.KeyFile = *key
+		}
+	})
+
+	err = config.Validate()
+	if err != nil {
+		fmt.Println("invalid configuration:", err.Error())
+		os.Exit(2)
+	}
+
+	player.Start(config)
 }